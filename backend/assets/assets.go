@@ -0,0 +1,200 @@
+package assets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+	"veedeo/media"
+	"veedeo/storage"
+
+	"github.com/google/uuid"
+)
+
+var ErrNotFound = errors.New("asset not found")
+
+// Asset is a validated video kept around so that several operations can
+// use it without uploading it again.
+type Asset struct {
+	ID   string
+	Size int64
+	Info *media.Info
+
+	key string
+
+	mutex     sync.Mutex
+	createdAt time.Time
+	usedAt    time.Time
+}
+
+// Description is the JSON representation of an asset.
+type Description struct {
+	ID        string      `json:"id"`
+	Size      int64       `json:"size"`
+	CreatedAt time.Time   `json:"createdAt"`
+	ExpiresAt time.Time   `json:"expiresAt"`
+	Info      *media.Info `json:"info"`
+}
+
+func (a *Asset) Describe(ttl time.Duration) Description {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return Description{
+		ID:        a.ID,
+		Size:      a.Size,
+		CreatedAt: a.createdAt,
+		ExpiresAt: a.usedAt.Add(ttl),
+		Info:      a.Info,
+	}
+}
+
+func (a *Asset) touch() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.usedAt = time.Now()
+}
+
+func (a *Asset) expired(ttl time.Duration) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return time.Since(a.usedAt) > ttl
+}
+
+// Store keeps assets in the default storage and removes the ones not used
+// for ttl.
+type Store struct {
+	ttl    time.Duration
+	assets map[string]*Asset
+	mutex  sync.Mutex
+}
+
+var AssetStore = NewStore(time.Hour)
+
+func NewStore(ttl time.Duration) *Store {
+	s := &Store{
+		ttl:    ttl,
+		assets: make(map[string]*Asset),
+	}
+	go s.cleanup()
+
+	return s
+}
+
+// Add stores the validated video at path, which is removed.
+func (s *Store) Add(ctx context.Context, path string, info *media.Info) (*Asset, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	asset := &Asset{
+		ID:        uuid.New().String(),
+		Size:      stat.Size(),
+		Info:      info,
+		createdAt: now,
+		usedAt:    now,
+	}
+	asset.key = "assets/" + asset.ID
+
+	if err := storage.Upload(ctx, storage.Default(), path, asset.key, ""); err != nil {
+		return nil, fmt.Errorf("failed to store asset: %w", err)
+	}
+	os.Remove(path)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.assets[asset.ID] = asset
+	return asset, nil
+}
+
+func (s *Store) Get(id string) (*Asset, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	asset, ok := s.assets[id]
+	return asset, ok
+}
+
+// Delete removes asset id and its file.
+func (s *Store) Delete(id string) bool {
+	s.mutex.Lock()
+	asset, ok := s.assets[id]
+	delete(s.assets, id)
+	s.mutex.Unlock()
+
+	if !ok {
+		return false
+	}
+	removeFile(asset)
+	return true
+}
+
+// Clear removes every asset, whose file would otherwise be left behind by
+// a restart.
+func (s *Store) Clear() {
+	s.mutex.Lock()
+	assets := s.assets
+	s.assets = make(map[string]*Asset)
+	s.mutex.Unlock()
+
+	for _, asset := range assets {
+		removeFile(asset)
+	}
+}
+
+// CopyTo makes asset id available at path and returns it. Using an asset
+// postpones its expiry.
+func (s *Store) CopyTo(ctx context.Context, id, path string) (*Asset, error) {
+	asset, ok := s.Get(id)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	asset.touch()
+
+	if err := storage.Download(ctx, storage.Default(), asset.key, path); err != nil {
+		return nil, err
+	}
+	return asset, nil
+}
+
+// TTL returns how long assets are kept once left unused.
+func (s *Store) TTL() time.Duration {
+	return s.ttl
+}
+
+// removeFile deletes the stored file of asset, which may take a while with
+// remote storages, so the mutex must not be held.
+func removeFile(asset *Asset) {
+	if err := storage.Default().Delete(context.Background(), asset.key); err != nil {
+		log.Printf("Error removing asset %s: %v", asset.ID, err)
+	}
+}
+
+func (s *Store) cleanup() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		var expired []*Asset
+		s.mutex.Lock()
+		for id, asset := range s.assets {
+			if asset.expired(s.ttl) {
+				expired = append(expired, asset)
+				delete(s.assets, id)
+			}
+		}
+		s.mutex.Unlock()
+
+		for _, asset := range expired {
+			removeFile(asset)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package assets
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+func AssetHandler(w http.ResponseWriter, r *http.Request) {
+	asset, ok := AssetStore.Get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Asset not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(asset.Describe(AssetStore.TTL()))
+}
+
+func AssetDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	if !AssetStore.Delete(r.PathValue("id")) {
+		http.Error(w, "Asset not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,174 @@
+// Package cobalt is a client of the cobalt JSON API
+// (https://github.com/imputnet/cobalt/blob/main/docs/api.md), which resolves
+// social media posts to downloadable media.
+package cobalt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"veedeo/config"
+)
+
+var ErrNoVideo = errors.New("no video found")
+
+// Request is the body of a cobalt API request. Empty fields use the
+// instance defaults.
+type Request struct {
+	URL           string `json:"url"`
+	VideoQuality  string `json:"videoQuality,omitempty"`
+	DownloadMode  string `json:"downloadMode,omitempty"`
+	FilenameStyle string `json:"filenameStyle,omitempty"`
+}
+
+// Response statuses.
+const (
+	StatusTunnel   = "tunnel"
+	StatusRedirect = "redirect"
+	StatusPicker   = "picker"
+	StatusError    = "error"
+)
+
+// Response is the body of a cobalt API response.
+type Response struct {
+	Status   string       `json:"status"`
+	URL      string       `json:"url,omitempty"`
+	Filename string       `json:"filename,omitempty"`
+	Picker   []PickerItem `json:"picker,omitempty"`
+	Error    *Error       `json:"error,omitempty"`
+}
+
+// PickerItem is one of the media of a post containing several.
+type PickerItem struct {
+	Type  string `json:"type"`
+	URL   string `json:"url"`
+	Thumb string `json:"thumb,omitempty"`
+}
+
+// Error is an error reported by the instance, such as
+// "error.api.link.unsupported".
+type Error struct {
+	Code    string         `json:"code"`
+	Context map[string]any `json:"context,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return "cobalt: " + e.Code
+}
+
+// Media is a downloadable video resolved by cobalt.
+type Media struct {
+	URL      string
+	Filename string
+}
+
+// Client calls the API of the cobalt instance at BaseURL.
+type Client struct {
+	BaseURL string
+	// APIKey is sent as "Authorization: Api-Key <key>" when not empty.
+	APIKey     string
+	HTTPClient *http.Client
+}
+
+func NewClient(baseURL, apiKey string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		APIKey:     apiKey,
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+var (
+	defaultClient     *Client
+	defaultClientOnce sync.Once
+)
+
+// Default returns the client of the instance of the cobalt section of the
+// configuration, or nil when no instance is set.
+func Default() *Client {
+	defaultClientOnce.Do(func() {
+		if cfg := config.Current().Cobalt; cfg.APIURL != "" {
+			defaultClient = NewClient(cfg.APIURL, cfg.APIKey)
+		}
+	})
+	return defaultClient
+}
+
+// Do sends req to the instance and returns its response. Errors reported by
+// the instance are returned as *Error.
+func (c *Client) Do(ctx context.Context, req Request) (*Response, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Accept", "application/json")
+	httpReq.Header.Set("Content-Type", "application/json")
+	if c.APIKey != "" {
+		httpReq.Header.Set("Authorization", "Api-Key "+c.APIKey)
+	}
+
+	httpResp, err := c.HTTPClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("cobalt: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	var resp Response
+	if err := json.NewDecoder(io.LimitReader(httpResp.Body, 1<<20)).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("cobalt: invalid response (HTTP %d): %w", httpResp.StatusCode, err)
+	}
+
+	if resp.Status == StatusError {
+		if resp.Error == nil {
+			resp.Error = &Error{Code: "error.unknown"}
+		}
+		return nil, resp.Error
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cobalt: unexpected HTTP %d", httpResp.StatusCode)
+	}
+
+	return &resp, nil
+}
+
+// Resolve returns the video of the post at req.URL. Posts containing several
+// media resolve to their first video.
+func (c *Client) Resolve(ctx context.Context, req Request) (*Media, error) {
+	if req.DownloadMode == "" {
+		req.DownloadMode = "auto"
+	}
+
+	resp, err := c.Do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.Status {
+	case StatusTunnel, StatusRedirect:
+		if resp.URL == "" {
+			return nil, fmt.Errorf("cobalt: %s response without url", resp.Status)
+		}
+		return &Media{URL: resp.URL, Filename: resp.Filename}, nil
+	case StatusPicker:
+		for _, item := range resp.Picker {
+			if item.Type == "video" && item.URL != "" {
+				return &Media{URL: item.URL}, nil
+			}
+		}
+		return nil, ErrNoVideo
+	default:
+		return nil, fmt.Errorf("cobalt: unsupported response status %q", resp.Status)
+	}
+}
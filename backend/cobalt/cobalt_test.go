@@ -0,0 +1,148 @@
+package cobalt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTestClient returns a client of an instance replying status and body to
+// every request, after checking the request is a valid API call.
+func newTestClient(t *testing.T, status int, body string) *Client {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/" {
+			t.Errorf("got %s %s, want POST /", r.Method, r.URL.Path)
+		}
+		if got := r.Header.Get("Accept"); got != "application/json" {
+			t.Errorf("Accept = %q, want application/json", got)
+		}
+		if got := r.Header.Get("Authorization"); got != "Api-Key secret" {
+			t.Errorf("Authorization = %q, want Api-Key secret", got)
+		}
+
+		var req Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("invalid request body: %v", err)
+		}
+		if req.URL != "https://example.com/post" || req.DownloadMode != "auto" {
+			t.Errorf("got request %+v", req)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	return NewClient(server.URL+"/", "secret")
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   Media
+	}{
+		{
+			name:   "tunnel",
+			status: http.StatusOK,
+			body:   `{"status":"tunnel","url":"https://cobalt.example.com/tunnel?id=1","filename":"video.mp4"}`,
+			want:   Media{URL: "https://cobalt.example.com/tunnel?id=1", Filename: "video.mp4"},
+		},
+		{
+			name:   "redirect",
+			status: http.StatusOK,
+			body:   `{"status":"redirect","url":"https://cdn.example.com/video.mp4","filename":"video.mp4"}`,
+			want:   Media{URL: "https://cdn.example.com/video.mp4", Filename: "video.mp4"},
+		},
+		{
+			name:   "picker",
+			status: http.StatusOK,
+			body:   `{"status":"picker","picker":[{"type":"photo","url":"https://cdn.example.com/1.jpg"},{"type":"video","url":"https://cdn.example.com/2.mp4"}]}`,
+			want:   Media{URL: "https://cdn.example.com/2.mp4"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := newTestClient(t, test.status, test.body)
+
+			media, err := client.Resolve(context.Background(), Request{URL: "https://example.com/post"})
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+			if *media != test.want {
+				t.Errorf("Resolve() = %+v, want %+v", *media, test.want)
+			}
+		})
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		check  func(error) bool
+	}{
+		{
+			name:   "api error",
+			status: http.StatusBadRequest,
+			body:   `{"status":"error","error":{"code":"error.api.link.unsupported"}}`,
+			check: func(err error) bool {
+				var apiErr *Error
+				return errors.As(err, &apiErr) && apiErr.Code == "error.api.link.unsupported"
+			},
+		},
+		{
+			name:   "error without code",
+			status: http.StatusOK,
+			body:   `{"status":"error"}`,
+			check: func(err error) bool {
+				var apiErr *Error
+				return errors.As(err, &apiErr) && apiErr.Code == "error.unknown"
+			},
+		},
+		{
+			name:   "picker without video",
+			status: http.StatusOK,
+			body:   `{"status":"picker","picker":[{"type":"photo","url":"https://cdn.example.com/1.jpg"}]}`,
+			check:  func(err error) bool { return errors.Is(err, ErrNoVideo) },
+		},
+		{
+			name:   "tunnel without url",
+			status: http.StatusOK,
+			body:   `{"status":"tunnel"}`,
+			check:  func(err error) bool { return err != nil },
+		},
+		{
+			name:   "unexpected HTTP status",
+			status: http.StatusInternalServerError,
+			body:   `{"status":"tunnel","url":"https://cobalt.example.com/tunnel?id=1"}`,
+			check:  func(err error) bool { return err != nil },
+		},
+		{
+			name:   "invalid JSON",
+			status: http.StatusBadGateway,
+			body:   `<html>Bad Gateway</html>`,
+			check:  func(err error) bool { return err != nil },
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := newTestClient(t, test.status, test.body)
+
+			media, err := client.Resolve(context.Background(), Request{URL: "https://example.com/post"})
+			if media != nil || !test.check(err) {
+				t.Errorf("Resolve() = %+v, %v", media, err)
+			}
+		})
+	}
+}
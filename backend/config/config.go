@@ -0,0 +1,198 @@
+// Package config holds the server settings, read at startup from defaults,
+// an optional YAML file, env variables and command line flags, each one
+// overriding the previous.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// Config is the server configuration. Each setting is named after its YAML
+// key, overridden by the env variable of its env tag and by the flag made
+// of its section and key, e.g. -ffmpeg.max-concurrent. APP_ENV=PROD is not
+// a setting: it is read before anything else to skip the .env file.
+type Config struct {
+	Addr string `yaml:"addr" env:"ADDR" usage:"address the server listens on"`
+	// ShutdownTimeout is how long running jobs and requests get to finish
+	// once the server is asked to stop, before they are killed.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" usage:"time given to running jobs on shutdown, e.g. 60s"`
+
+	CORS    CORS    `yaml:"cors"`
+	SAM2Seg SAM2Seg `yaml:"sam2seg"`
+	Media   Media   `yaml:"media"`
+	FFmpeg  FFmpeg  `yaml:"ffmpeg"`
+	Storage Storage `yaml:"storage"`
+	S3      S3      `yaml:"s3"`
+	Import  Import  `yaml:"import"`
+	Cobalt  Cobalt  `yaml:"cobalt"`
+}
+
+type CORS struct {
+	AllowedOrigins []string `yaml:"allowed_origins" env:"CORS_ALLOWED_ORIGINS" usage:"origins allowed to call the API"`
+}
+
+// SAM2Seg locates the python segmentation server.
+type SAM2Seg struct {
+	Host      string `yaml:"host" env:"SAM2SEG_HOST" usage:"host:port of the segmentation server"`
+	SharedDir string `yaml:"shared_dir" env:"SAM2SEG_SHARED_DIR" usage:"directory shared with the segmentation server"`
+}
+
+// Media lists the containers and codecs accepted for uploads.
+type Media struct {
+	AllowedContainers  []string `yaml:"allowed_containers" env:"MEDIA_ALLOWED_CONTAINERS" usage:"accepted containers"`
+	AllowedVideoCodecs []string `yaml:"allowed_video_codecs" env:"MEDIA_ALLOWED_VIDEO_CODECS" usage:"accepted video codecs"`
+	AllowedAudioCodecs []string `yaml:"allowed_audio_codecs" env:"MEDIA_ALLOWED_AUDIO_CODECS" usage:"accepted audio codecs"`
+}
+
+// FFmpeg limits the ffmpeg processes, 0 meaning unlimited for the
+// resources. MaxConcurrent and MaxQueue also size the job queue: as many
+// jobs run at once as ffmpeg processes, and as many wait.
+type FFmpeg struct {
+	MaxConcurrent int `yaml:"max_concurrent" env:"FFMPEG_MAX_CONCURRENT" usage:"ffmpeg processes and jobs running at once"`
+	MaxQueue      int `yaml:"max_queue" env:"FFMPEG_MAX_QUEUE" usage:"ffmpeg processes and jobs waiting to run"`
+	MaxMemoryMB   int `yaml:"max_memory_mb" env:"FFMPEG_MAX_MEMORY_MB" usage:"data segment of each ffmpeg process in MB, thread stacks included"`
+	MaxCPUSeconds int `yaml:"max_cpu_seconds" env:"FFMPEG_MAX_CPU_SECONDS" usage:"CPU time of each ffmpeg process in seconds"`
+}
+
+type Storage struct {
+	Backend    string `yaml:"backend" env:"STORAGE_BACKEND" usage:"local or s3"`
+	Dir        string `yaml:"dir" env:"STORAGE_DIR" usage:"directory of the local storage"`
+	SigningKey string `yaml:"signing_key" env:"STORAGE_SIGNING_KEY" secret:"true" usage:"key signing the local download links, random when empty"`
+}
+
+type S3 struct {
+	Endpoint        string `yaml:"endpoint" env:"S3_ENDPOINT" usage:"endpoint of S3 compatible stores"`
+	PublicEndpoint  string `yaml:"public_endpoint" env:"S3_PUBLIC_ENDPOINT" usage:"endpoint of the download links when clients reach the store at another address"`
+	Region          string `yaml:"region" env:"S3_REGION" usage:"bucket region"`
+	Bucket          string `yaml:"bucket" env:"S3_BUCKET" usage:"bucket name"`
+	AccessKeyID     string `yaml:"access_key_id" env:"S3_ACCESS_KEY_ID" usage:"access key ID"`
+	SecretAccessKey string `yaml:"secret_access_key" env:"S3_SECRET_ACCESS_KEY" secret:"true" usage:"secret access key"`
+	UsePathStyle    bool   `yaml:"use_path_style" env:"S3_USE_PATH_STYLE" usage:"address the bucket in the path, as MinIO needs"`
+}
+
+// Import restricts the videos imported from URLs.
+type Import struct {
+	AllowedDomains []string `yaml:"allowed_domains" env:"IMPORT_ALLOWED_DOMAINS" usage:"domains yt-dlp and cobalt imports may come from"`
+	// MaxDuration is in seconds.
+	MaxDuration  float64  `yaml:"max_duration" env:"IMPORT_MAX_DURATION" usage:"longest imported video in seconds"`
+	MaxSizeMB    int64    `yaml:"max_size_mb" env:"IMPORT_MAX_SIZE_MB" usage:"largest imported video in MB"`
+	MaxRedirects int      `yaml:"max_redirects" env:"IMPORT_MAX_REDIRECTS" usage:"redirects followed by URL imports"`
+	TrustedHosts []string `yaml:"trusted_hosts" env:"IMPORT_TRUSTED_HOSTS" usage:"hosts URL imports may reach on private networks"`
+}
+
+type Cobalt struct {
+	APIURL string `yaml:"api_url" env:"COBALT_API_URL" usage:"cobalt instance, cobalt imports are disabled when empty"`
+	APIKey string `yaml:"api_key" env:"COBALT_API_KEY" secret:"true" usage:"cobalt instance API key"`
+}
+
+// Defaults returns the configuration used for the settings left unset.
+func Defaults() *Config {
+	return &Config{
+		Addr:            ":8080",
+		ShutdownTimeout: time.Minute,
+		CORS: CORS{
+			AllowedOrigins: []string{"http://localhost:9000", "https://vvvdeo.pages.dev", "https://vvvdeo.com", "http://localhost:5173", "http://localhost:5174", "https://api.vvvdeo.com"},
+		},
+		SAM2Seg: SAM2Seg{
+			Host:      "localhost:9000",
+			SharedDir: "../local/sam2seg",
+		},
+		Media: Media{
+			AllowedContainers:  []string{"mp4", "mov", "webm", "mkv"},
+			AllowedVideoCodecs: []string{"h264", "hevc", "vp8", "vp9", "av1", "mpeg4", "prores"},
+			AllowedAudioCodecs: []string{"aac", "mp3", "opus", "vorbis", "flac", "ac3", "alac", "pcm_s16le"},
+		},
+		FFmpeg: FFmpeg{
+			MaxConcurrent: 1,
+			MaxQueue:      8,
+		},
+		Storage: Storage{
+			Backend: "local",
+			Dir:     filepath.Join(os.TempDir(), "veedeo-storage"),
+		},
+		S3: S3{
+			Region: "us-east-1",
+		},
+		Import: Import{
+			AllowedDomains: []string{"youtube.com", "youtu.be", "vimeo.com", "x.com", "twitter.com", "reddit.com", "streamable.com", "tiktok.com", "instagram.com"},
+			MaxDuration:    15 * 60,
+			MaxSizeMB:      500,
+			MaxRedirects:   5,
+		},
+	}
+}
+
+// Validate reports every invalid setting.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	_, _, err := net.SplitHostPort(c.Addr)
+	check(err == nil, "addr %q is not a host:port address", c.Addr)
+	check(c.ShutdownTimeout > 0, "shutdown_timeout must be positive")
+
+	for _, origin := range c.CORS.AllowedOrigins {
+		check(origin == "*" || validURL(origin), "cors.allowed_origins: %q is not an http(s) origin", origin)
+	}
+
+	check(c.SAM2Seg.Host != "", "sam2seg.host is required")
+
+	check(len(c.Media.AllowedContainers) > 0, "media.allowed_containers can't be empty")
+	check(len(c.Media.AllowedVideoCodecs) > 0, "media.allowed_video_codecs can't be empty")
+
+	check(c.FFmpeg.MaxConcurrent >= 1, "ffmpeg.max_concurrent must be at least 1")
+	check(c.FFmpeg.MaxQueue >= 0, "ffmpeg.max_queue can't be negative")
+	check(c.FFmpeg.MaxMemoryMB >= 0, "ffmpeg.max_memory_mb can't be negative")
+	check(c.FFmpeg.MaxCPUSeconds >= 0, "ffmpeg.max_cpu_seconds can't be negative")
+
+	switch c.Storage.Backend {
+	case "local":
+		check(c.Storage.Dir != "", "storage.dir is required by the local storage")
+	case "s3":
+		check(c.S3.Bucket != "", "s3.bucket is required by the s3 storage")
+		check(c.S3.AccessKeyID != "" && c.S3.SecretAccessKey != "", "s3 credentials are required by the s3 storage")
+		check(c.S3.Endpoint == "" || validURL(c.S3.Endpoint), "s3.endpoint %q is not an http(s) URL", c.S3.Endpoint)
+		check(c.S3.PublicEndpoint == "" || validURL(c.S3.PublicEndpoint), "s3.public_endpoint %q is not an http(s) URL", c.S3.PublicEndpoint)
+	default:
+		check(false, "storage.backend %q is neither local nor s3", c.Storage.Backend)
+	}
+
+	check(c.Import.MaxDuration > 0, "import.max_duration must be positive")
+	check(c.Import.MaxSizeMB > 0, "import.max_size_mb must be positive")
+	check(c.Import.MaxRedirects >= 0, "import.max_redirects can't be negative")
+
+	check(c.Cobalt.APIURL == "" || validURL(c.Cobalt.APIURL), "cobalt.api_url %q is not an http(s) URL", c.Cobalt.APIURL)
+
+	return errors.Join(errs...)
+}
+
+func validURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+var current atomic.Pointer[Config]
+
+// Current returns the configuration set at startup, or the defaults.
+func Current() *Config {
+	if c := current.Load(); c != nil {
+		return c
+	}
+	return Defaults()
+}
+
+// Set makes c the configuration returned by Current.
+func Set(c *Config) {
+	current.Store(c)
+}
@@ -0,0 +1,215 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// setting is a configuration field with the names it is read from.
+type setting struct {
+	value  reflect.Value
+	key    string
+	env    string
+	flag   string
+	usage  string
+	secret bool
+}
+
+// settings lists the fields of c, walking its sections.
+func settings(c *Config) []setting {
+	var list []setting
+
+	var walk func(v reflect.Value, prefix string)
+	walk = func(v reflect.Value, prefix string) {
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			key := prefix + field.Tag.Get("yaml")
+
+			if field.Type.Kind() == reflect.Struct {
+				walk(v.Field(i), key+".")
+				continue
+			}
+
+			list = append(list, setting{
+				value:  v.Field(i),
+				key:    key,
+				env:    field.Tag.Get("env"),
+				flag:   strings.ReplaceAll(key, "_", "-"),
+				usage:  field.Tag.Get("usage"),
+				secret: field.Tag.Get("secret") == "true",
+			})
+		}
+	}
+	walk(reflect.ValueOf(c).Elem(), "")
+
+	return list
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// set parses value into the setting, lists being comma separated.
+func (s setting) set(value string) error {
+	if s.value.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		s.value.SetInt(int64(d))
+		return nil
+	}
+
+	switch s.value.Kind() {
+	case reflect.String:
+		s.value.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		s.value.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		s.value.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		s.value.SetFloat(f)
+	case reflect.Slice:
+		var list []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		s.value.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("unsupported setting type %s", s.value.Type())
+	}
+	return nil
+}
+
+// pendingFlag is a flag value applied once the file and env are loaded, so
+// that flags take precedence.
+type pendingFlag struct {
+	name    string
+	value   string
+	pending *[]pendingFlag
+	isBool  bool
+}
+
+func (p *pendingFlag) String() string   { return "" }
+func (p *pendingFlag) IsBoolFlag() bool { return p.isBool }
+
+func (p *pendingFlag) Set(value string) error {
+	*p.pending = append(*p.pending, pendingFlag{name: p.name, value: value})
+	return nil
+}
+
+// Load reads the configuration from the defaults, the YAML file given by
+// -config or CONFIG_FILE, the env and the command line args, then validates
+// it. Outside of production the env is first completed from the .env file.
+// printConfig reports whether -print-config was given.
+func Load(args []string) (c *Config, printConfig bool, err error) {
+	if os.Getenv("APP_ENV") != "PROD" {
+		if err := godotenv.Load(); err != nil {
+			log.Println("Error loading .env file!")
+		}
+	} else {
+		log.Println("Running in production mode, skipping .env file")
+	}
+
+	c = Defaults()
+	list := settings(c)
+
+	fs := flag.NewFlagSet("veedeo", flag.ContinueOnError)
+	file := fs.String("config", os.Getenv("CONFIG_FILE"), "YAML configuration file (env CONFIG_FILE)")
+	fs.BoolVar(&printConfig, "print-config", false, "print the configuration, secrets redacted, and exit")
+
+	var pending []pendingFlag
+	for _, s := range list {
+		usage := s.usage
+		if s.env != "" {
+			usage += fmt.Sprintf(" (env %s)", s.env)
+		}
+		fs.Var(&pendingFlag{name: s.flag, pending: &pending, isBool: s.value.Kind() == reflect.Bool}, s.flag, usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, false, err
+	}
+
+	if *file != "" {
+		data, err := os.ReadFile(*file)
+		if err != nil {
+			return nil, false, err
+		}
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+			return nil, false, fmt.Errorf("%s: %w", *file, err)
+		}
+	}
+
+	// empty variables are ignored, like unset ones
+	for _, s := range list {
+		if value := os.Getenv(s.env); s.env != "" && value != "" {
+			if err := s.set(value); err != nil {
+				return nil, false, fmt.Errorf("env %s: %w", s.env, err)
+			}
+		}
+	}
+
+	for _, p := range pending {
+		for _, s := range list {
+			if s.flag != p.name {
+				continue
+			}
+			if err := s.set(p.value); err != nil {
+				return nil, false, fmt.Errorf("flag -%s: %w", p.name, err)
+			}
+		}
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, false, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+
+	return c, printConfig, nil
+}
+
+// Redacted returns a copy of c with the secrets replaced.
+func (c *Config) Redacted() *Config {
+	redacted := *c
+	for _, s := range settings(&redacted) {
+		if s.secret && s.value.String() != "" {
+			s.value.SetString("REDACTED")
+		}
+	}
+	return &redacted
+}
+
+// Print writes the configuration as YAML, secrets redacted.
+func (c *Config) Print(w io.Writer) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c.Redacted()); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
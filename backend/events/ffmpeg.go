@@ -9,19 +9,45 @@ import (
 
 var SseManager = NewSSEManager()
 
+// NewJobID returns a fresh id to be used as an SSE topic.
+func NewJobID() string {
+	return uuid.New().String()
+}
+
+// ValidJobID reports whether id looks like an id returned by NewJobID.
+func ValidJobID(id string) bool {
+	_, err := uuid.Parse(id)
+	return err == nil
+}
+
 func FfmpegEventsHandler(w http.ResponseWriter, r *http.Request) {
+	jobID := r.URL.Query().Get("job")
+	if !ValidJobID(jobID) {
+		http.Error(w, "Missing or invalid job id.", http.StatusBadRequest)
+		return
+	}
+
 	id := uuid.New().String()
-	ch := SseManager.Subscribe(id)
-	defer SseManager.Unsubscribe(id)
+	ch := SseManager.Subscribe(jobID, id)
+	defer SseManager.Unsubscribe(jobID, id)
 
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Connection", "keep-alive")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("X-Accel-Buffering", "no")
+	w.(http.Flusher).Flush()
 
-	for msg := range ch {
-		content := fmt.Sprintf("data: %s\n\n", msg)
-		w.Write([]byte(content))
-		w.(http.Flusher).Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			content := fmt.Sprintf("data: %s\n\n", msg)
+			w.Write([]byte(content))
+			w.(http.Flusher).Flush()
+		}
 	}
 }
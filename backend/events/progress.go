@@ -0,0 +1,37 @@
+package events
+
+import (
+	"encoding/json"
+	"log"
+)
+
+// Progress is the payload streamed to /ffmpeg-events subscribers while a
+// job is running. ETA is expressed in seconds. Queue is the position of the
+// job while waiting for ffmpeg to be available.
+type Progress struct {
+	Stage   string  `json:"stage"`
+	Percent float64 `json:"percent"`
+	FPS     float64 `json:"fps,omitempty"`
+	ETA     float64 `json:"eta,omitempty"`
+	Queue   int     `json:"queue,omitempty"`
+}
+
+// StageShuttingDown is the stage of the last event sent to every
+// subscriber when the server shuts down.
+const StageShuttingDown = "shutting down"
+
+func (s *SSEManager) UpdateProgress(topic string, p Progress) {
+	message, err := json.Marshal(p)
+	if err != nil {
+		log.Println("Error encoding progress:", err)
+		return
+	}
+
+	s.Update(topic, string(message))
+}
+
+// Shutdown ends every stream with a StageShuttingDown progress event.
+func (s *SSEManager) Shutdown() {
+	message, _ := json.Marshal(Progress{Stage: StageShuttingDown})
+	s.Close(string(message))
+}
@@ -4,47 +4,146 @@ import (
 	"sync"
 )
 
+// SSEManager fans out messages to subscribers grouped by topic.
+// A topic is usually the id of the job whose progress is being streamed.
+// The last message of each topic is replayed to new subscribers, so a
+// client subscribing after a job started still gets its current state.
 type SSEManager struct {
-	subscribers map[string]chan string
-	mutex       sync.Mutex
+	topics map[string]map[string]chan string
+	last   map[string]string
+	// claimed are the topics published to by a request, see Claim
+	claimed map[string]bool
+	mutex   sync.Mutex
+
+	// closing is the final message once closed
+	closed  bool
+	closing string
 }
 
 func NewSSEManager() *SSEManager {
 	return &SSEManager{
-		subscribers: make(map[string]chan string),
+		topics:  make(map[string]map[string]chan string),
+		last:    make(map[string]string),
+		claimed: make(map[string]bool),
 	}
 }
 
-func (s *SSEManager) Subscribe(id string) chan string {
+func (s *SSEManager) Subscribe(topic, id string) chan string {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
 	ch := make(chan string, 20)
-	s.subscribers[id] = ch
+
+	if s.closed {
+		ch <- s.closing
+		close(ch)
+		return ch
+	}
+
+	subscribers, ok := s.topics[topic]
+	if !ok {
+		subscribers = make(map[string]chan string)
+		s.topics[topic] = subscribers
+	}
+	subscribers[id] = ch
+
+	if message, ok := s.last[topic]; ok {
+		ch <- message
+	}
 
 	return ch
 }
 
-func (s *SSEManager) Unsubscribe(id string) {
+func (s *SSEManager) Unsubscribe(topic, id string) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	if ch, ok := s.subscribers[id]; ok {
+	subscribers, ok := s.topics[topic]
+	if !ok {
+		return
+	}
+
+	if ch, ok := subscribers[id]; ok {
 		close(ch)
-		delete(s.subscribers, id)
+		delete(subscribers, id)
+	}
+
+	if len(subscribers) == 0 {
+		delete(s.topics, topic)
 	}
 }
 
-func (s *SSEManager) Update(message string) {
+// Update sends message to the subscribers of topic only.
+func (s *SSEManager) Update(topic, message string) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	for id, ch := range s.subscribers {
+	s.last[topic] = message
+
+	subscribers, ok := s.topics[topic]
+	if !ok {
+		return
+	}
+
+	for id, ch := range subscribers {
 		select {
 		case ch <- message:
 		default:
 			close(ch)
-			delete(s.subscribers, id)
+			delete(subscribers, id)
 		}
 	}
+
+	if len(subscribers) == 0 {
+		delete(s.topics, topic)
+	}
+}
+
+// Close sends message to every subscriber then closes them, and does the
+// same for later subscribers, ending every stream.
+func (s *SSEManager) Close(message string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.closed = true
+	s.closing = message
+
+	for topic, subscribers := range s.topics {
+		for _, ch := range subscribers {
+			select {
+			case ch <- message:
+			default:
+			}
+			close(ch)
+		}
+		delete(s.topics, topic)
+	}
+}
+
+// Claim reserves topic for a single publisher until it is forgotten. It
+// fails when the topic is already claimed or has been published to, so a
+// client choosing its topic can't write to the stream of someone else.
+func (s *SSEManager) Claim(topic string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.last[topic]; ok || s.claimed[topic] {
+		return false
+	}
+	s.claimed[topic] = true
+	return true
+}
+
+// Forget closes every subscriber of topic, drops its last message and
+// releases its claim.
+func (s *SSEManager) Forget(topic string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, ch := range s.topics[topic] {
+		close(ch)
+	}
+	delete(s.topics, topic)
+	delete(s.last, topic)
+	delete(s.claimed, topic)
 }
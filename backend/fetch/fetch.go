@@ -0,0 +1,274 @@
+// Package fetch downloads media from user supplied URLs without letting
+// them reach the server's own network.
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+	"veedeo/config"
+	"veedeo/media"
+)
+
+var (
+	ErrBlockedAddress    = errors.New("address not allowed")
+	ErrTooManyRedirects  = errors.New("too many redirects")
+	ErrTooLarge          = errors.New("media too large")
+	ErrContentType       = errors.New("content type not allowed")
+	ErrUnexpectedStatus  = errors.New("unexpected HTTP status")
+	errUnsupportedScheme = errors.New("only http and https URLs are allowed")
+)
+
+// blockedPrefixes are the ranges not covered by the netip.Addr predicates
+// used in blocked.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "this" network
+	netip.MustParsePrefix("100.64.0.0/10"),   // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved, broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),    // NAT64 of any IPv4, private ones included
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // local NAT64
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+	netip.MustParsePrefix("2002::/16"),       // 6to4 of any IPv4, private ones included
+	netip.MustParsePrefix("fec0::/10"),       // deprecated site-local
+	netip.MustParsePrefix("2001::/32"),       // Teredo
+	netip.MustParsePrefix("::ffff:0:0:0/96"), // IPv4-translated
+}
+
+// blocked reports whether addr is private, loopback, link-local or otherwise
+// not a public unicast address.
+func blocked(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() || addr.IsLoopback() || addr.IsLinkLocalUnicast() {
+		return true
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Fetcher downloads media over http(s), refusing to connect to non public
+// addresses once the host names are resolved, so neither DNS nor redirects
+// can point it to internal services.
+type Fetcher struct {
+	// MaxRedirects is how many redirects are followed.
+	MaxRedirects int
+	// MaxSize is the largest body downloaded, in bytes.
+	MaxSize int64
+	// ContentTypes are the accepted media types, "video/*" accepts any video.
+	ContentTypes []string
+	// TrustedHosts are host or host:port names connected to whatever their
+	// address, such as our own bucket or cobalt instance.
+	TrustedHosts []string
+	// Timeout bounds the connection and the wait for the response headers,
+	// the body download is only bounded by the context.
+	Timeout time.Duration
+}
+
+func New(maxSize int64) *Fetcher {
+	return &Fetcher{
+		MaxRedirects: 5,
+		MaxSize:      maxSize,
+		ContentTypes: []string{"video/*", "application/octet-stream", "binary/octet-stream"},
+		Timeout:      30 * time.Second,
+	}
+}
+
+// Default returns a fetcher configured by the import section of the
+// configuration.
+func Default() *Fetcher {
+	cfg := config.Current().Import
+
+	f := New(cfg.MaxSizeMB * 1024 * 1024)
+	f.MaxRedirects = cfg.MaxRedirects
+	for _, host := range cfg.TrustedHosts {
+		f.TrustedHosts = append(f.TrustedHosts, strings.ToLower(host))
+	}
+
+	return f
+}
+
+// Trust returns a copy of the fetcher also trusting the host of rawURL.
+func (f *Fetcher) Trust(rawURL string) *Fetcher {
+	trusted := *f
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		trusted.TrustedHosts = append(slices.Clone(f.TrustedHosts), strings.ToLower(u.Host))
+	}
+	return &trusted
+}
+
+func (f *Fetcher) trusted(hostport string) bool {
+	host, _, _ := net.SplitHostPort(hostport)
+	return slices.Contains(f.TrustedHosts, hostport) || slices.Contains(f.TrustedHosts, host)
+}
+
+// dialContext connects to addr, checking the resolved address right before
+// connecting unless the host is trusted.
+func (f *Fetcher) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: f.Timeout}
+	if !f.trusted(strings.ToLower(addr)) {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if blocked(addrPort.Addr()) {
+				return fmt.Errorf("%w: %s", ErrBlockedAddress, addrPort.Addr())
+			}
+			return nil
+		}
+	}
+	return dialer.DialContext(ctx, network, addr)
+}
+
+func (f *Fetcher) client() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			// a proxy would connect on our behalf, bypassing the checks
+			Proxy:                 nil,
+			DialContext:           f.dialContext,
+			TLSHandshakeTimeout:   f.Timeout,
+			ResponseHeaderTimeout: f.Timeout,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > f.MaxRedirects {
+				return ErrTooManyRedirects
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return errUnsupportedScheme
+			}
+			return nil
+		},
+	}
+}
+
+// allowedContentType reports whether the Content-Type header value is one
+// of ContentTypes. A missing header is accepted, the body is sniffed anyway.
+func (f *Fetcher) allowedContentType(header string) bool {
+	if header == "" {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range f.ContentTypes {
+		if mediaType == allowed || (strings.HasSuffix(allowed, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(allowed, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// Fetch downloads rawURL to path, calling onProgress when not nil with the
+// bytes written so far and the total, -1 when unknown. The response must
+// have an allowed content type and start like a recognized video container
+// before anything is written. Nothing is left at path on failure.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL, path string, onProgress func(written, total int64)) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errUnsupportedScheme
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	client := f.client()
+	defer client.CloseIdleConnections()
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s", ErrUnexpectedStatus, resp.Status)
+	}
+	if resp.ContentLength > f.MaxSize {
+		return fmt.Errorf("%w: %d bytes, at most %d", ErrTooLarge, resp.ContentLength, f.MaxSize)
+	}
+	if contentType := resp.Header.Get("Content-Type"); !f.allowedContentType(contentType) {
+		return fmt.Errorf("%w: %s", ErrContentType, contentType)
+	}
+
+	header := make([]byte, 512)
+	n, err := io.ReadFull(resp.Body, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return err
+	}
+	header = header[:n]
+	if _, err := media.SniffHeader(header); err != nil {
+		return fmt.Errorf("%w: %v", ErrContentType, err)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	written, err := f.copy(file, io.MultiReader(bytes.NewReader(header), resp.Body), resp.ContentLength, onProgress)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && resp.ContentLength >= 0 && written != resp.ContentLength {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	return nil
+}
+
+// copy copies r to w, failing once more than MaxSize bytes have been read.
+func (f *Fetcher) copy(w io.Writer, r io.Reader, total int64, onProgress func(written, total int64)) (int64, error) {
+	buffer := make([]byte, 64*1024)
+	limited := io.LimitReader(r, f.MaxSize+1)
+
+	var written int64
+	for {
+		n, err := limited.Read(buffer)
+		if n > 0 {
+			written += int64(n)
+			if written > f.MaxSize {
+				return written, fmt.Errorf("%w: more than %d bytes", ErrTooLarge, f.MaxSize)
+			}
+			if _, err := w.Write(buffer[:n]); err != nil {
+				return written, err
+			}
+			if onProgress != nil {
+				onProgress(written, total)
+			}
+		}
+		if err == io.EOF {
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+	}
+}
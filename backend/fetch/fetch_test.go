@@ -0,0 +1,208 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestBlocked(t *testing.T) {
+	tests := []struct {
+		addr    string
+		blocked bool
+	}{
+		// loopback and unspecified
+		{"127.0.0.1", true},
+		{"127.1.2.3", true},
+		{"::1", true},
+		{"0.0.0.0", true},
+		{"::", true},
+		// RFC 1918 and unique local
+		{"10.0.0.1", true},
+		{"172.16.5.4", true},
+		{"172.31.255.255", true},
+		{"192.168.1.1", true},
+		{"fc00::1", true},
+		{"fd12:3456::1", true},
+		// link-local, cloud metadata included
+		{"169.254.169.254", true},
+		{"fe80::1", true},
+		// carrier-grade NAT
+		{"100.64.0.1", true},
+		{"100.127.255.254", true},
+		// multicast, broadcast and reserved
+		{"224.0.0.1", true},
+		{"255.255.255.255", true},
+		{"240.0.0.1", true},
+		{"ff02::1", true},
+		// NAT64 of the metadata service and of a public address
+		{"64:ff9b::a9fe:a9fe", true},
+		{"64:ff9b::808:808", true},
+		{"64:ff9b:1::a00:1", true},
+		// 6to4 of 127.0.0.1
+		{"2002:7f00:1::", true},
+		// Teredo
+		{"2001:0:4136:e378:8000:63bf:3fff:fdd2", true},
+		// IPv4-mapped IPv6 of blocked addresses
+		{"::ffff:127.0.0.1", true},
+		{"::ffff:10.0.0.1", true},
+		{"::ffff:169.254.169.254", true},
+		// public
+		{"8.8.8.8", false},
+		{"1.1.1.1", false},
+		{"::ffff:8.8.8.8", false},
+		{"2606:4700:4700::1111", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.addr, func(t *testing.T) {
+			if got := blocked(netip.MustParseAddr(test.addr)); got != test.blocked {
+				t.Errorf("blocked(%s) = %v, want %v", test.addr, got, test.blocked)
+			}
+		})
+	}
+}
+
+// mp4Header is the start of an mp4 file, as sniffed by media.SniffHeader.
+var mp4Header = []byte("\x00\x00\x00\x18ftypisom\x00\x00\x02\x00")
+
+func mp4Body(size int) []byte {
+	body := make([]byte, size)
+	copy(body, mp4Header)
+	return body
+}
+
+// newTestServer serves:
+//   - /video: an mp4 of 1000 bytes
+//   - /redirect/N: N redirects ending at /video
+//   - /large: an mp4 of 2000 bytes with its Content-Length
+//   - /stream: an mp4 of 2000 bytes streamed without Content-Length
+//   - /html: an HTML page
+//   - /fake: HTML content served as video/mp4
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/video", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "video/mp4")
+		w.Write(mp4Body(1000))
+	})
+	mux.HandleFunc("/redirect/{n}", func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(r.PathValue("n"))
+		if n <= 1 {
+			http.Redirect(w, r, "/video", http.StatusFound)
+			return
+		}
+		http.Redirect(w, r, "/redirect/"+strconv.Itoa(n-1), http.StatusFound)
+	})
+	mux.HandleFunc("/large", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "video/mp4")
+		w.Header().Set("Content-Length", "2000")
+		w.Write(mp4Body(2000))
+	})
+	mux.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "video/mp4")
+		body := mp4Body(2000)
+		for len(body) > 0 {
+			w.Write(body[:200])
+			w.(http.Flusher).Flush()
+			body = body[200:]
+		}
+	})
+	mux.HandleFunc("/html", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte("<html><body>not a video</body></html>"))
+	})
+	mux.HandleFunc("/fake", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "video/mp4")
+		w.Write([]byte("<html><body>not a video</body></html>"))
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestFetch(t *testing.T) {
+	server := newTestServer(t)
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr error
+	}{
+		{"video", "/video", nil},
+		{"redirects within the limit", "/redirect/2", nil},
+		{"too many redirects", "/redirect/3", ErrTooManyRedirects},
+		{"Content-Length too large", "/large", ErrTooLarge},
+		{"stream too large", "/stream", ErrTooLarge},
+		{"content type", "/html", ErrContentType},
+		{"sniffed content", "/fake", ErrContentType},
+		{"not found", "/missing", ErrUnexpectedStatus},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := New(1500)
+			f.MaxRedirects = 2
+			// the test server listens on loopback
+			f = f.Trust(server.URL)
+
+			path := filepath.Join(t.TempDir(), "video")
+			var written int64
+			err := f.Fetch(context.Background(), server.URL+test.path, path, func(n, total int64) {
+				written = n
+			})
+
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Fatalf("Fetch() error = %v, want %v", err, test.wantErr)
+				}
+				if _, err := os.Stat(path); !os.IsNotExist(err) {
+					t.Errorf("file left after failure: %v", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Fetch() error = %v", err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, mp4Body(1000)) {
+				t.Errorf("fetched %d bytes, want the 1000 bytes served", len(data))
+			}
+			if written != 1000 {
+				t.Errorf("progress reported %d bytes, want 1000", written)
+			}
+		})
+	}
+}
+
+func TestFetchBlocksUntrustedLoopback(t *testing.T) {
+	server := newTestServer(t)
+
+	path := filepath.Join(t.TempDir(), "video")
+	err := New(1500).Fetch(context.Background(), server.URL+"/video", path, nil)
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Fatalf("Fetch() error = %v, want %v", err, ErrBlockedAddress)
+	}
+}
+
+func TestFetchRejectsSchemes(t *testing.T) {
+	for _, rawURL := range []string{"file:///etc/passwd", "ftp://example.com/video.mp4", "gopher://example.com/"} {
+		err := New(1500).Fetch(context.Background(), rawURL, filepath.Join(t.TempDir(), "video"), nil)
+		if !errors.Is(err, errUnsupportedScheme) {
+			t.Errorf("Fetch(%s) error = %v, want %v", rawURL, err, errUnsupportedScheme)
+		}
+	}
+}
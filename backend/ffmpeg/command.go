@@ -0,0 +1,113 @@
+package ffmpeg
+
+import (
+	"strings"
+)
+
+// Input is a file read by ffmpeg. Seek and To are input options in seconds
+// and are left out when zero.
+type Input struct {
+	Path    string
+	Format  string
+	Seek    float64
+	To      float64
+	Options []string
+}
+
+func (i Input) args() []string {
+	var args []string
+	if i.Seek > 0 {
+		args = append(args, "-ss", Seconds(i.Seek))
+	}
+	if i.To > 0 {
+		args = append(args, "-to", Seconds(i.To))
+	}
+	if i.Format != "" {
+		args = append(args, "-f", i.Format)
+	}
+	args = append(args, i.Options...)
+	return append(args, "-i", i.Path)
+}
+
+// Map selects a stream for an output, see MapLabel and MapStream.
+type Map string
+
+// MapLabel maps the output label of the filter graph.
+func MapLabel(label string) Map {
+	return Map("[" + label + "]")
+}
+
+// MapStream maps input streams by specifier, e.g. "0:v:0" or "0:a?".
+func MapStream(specifier string) Map {
+	return Map(specifier)
+}
+
+// Output is a file written by ffmpeg.
+type Output struct {
+	Path    string
+	Maps    []Map
+	Codec   string
+	Format  string
+	Options []string
+}
+
+func (o Output) args() []string {
+	var args []string
+	for _, m := range o.Maps {
+		args = append(args, "-map", string(m))
+	}
+	if o.Codec != "" {
+		args = append(args, "-c", o.Codec)
+	}
+	args = append(args, o.Options...)
+	if o.Format != "" {
+		args = append(args, "-f", o.Format)
+	}
+	return append(args, o.Path)
+}
+
+// Command is an ffmpeg invocation.
+type Command struct {
+	// Overwrite existing outputs without asking.
+	Overwrite bool
+	Options   []string
+	Inputs    []Input
+	Graph     *FilterGraph
+	Outputs   []Output
+}
+
+// Args returns the arguments of the ffmpeg command line, without the binary.
+func (c *Command) Args() []string {
+	args := append([]string{}, c.Options...)
+	if c.Overwrite {
+		args = append(args, "-y")
+	}
+	for _, input := range c.Inputs {
+		args = append(args, input.args()...)
+	}
+	if c.Graph != nil && len(c.Graph.Chains) > 0 {
+		args = append(args, "-filter_complex", c.Graph.String())
+	}
+	for _, output := range c.Outputs {
+		args = append(args, output.args()...)
+	}
+	return args
+}
+
+// String returns the command line quoted for a shell, for logging.
+func (c *Command) String() string {
+	args := c.Args()
+	quoted := make([]string, len(args)+1)
+	quoted[0] = "ffmpeg"
+	for i, arg := range args {
+		quoted[i+1] = quote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+func quote(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\n'\"\\$`;&|<>()[]*?!#~") {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
@@ -0,0 +1,91 @@
+package ffmpeg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCommandArgs(t *testing.T) {
+	var graph FilterGraph
+	graph.Add([]string{"0:v:0"}, []string{"v"}, NewFilter("scale", "640", "-2"))
+
+	tests := []struct {
+		name    string
+		command Command
+		want    string
+	}{
+		{
+			name: "input and output",
+			command: Command{
+				Inputs:  []Input{{Path: "in.mp4"}},
+				Outputs: []Output{{Path: "out.mp4"}},
+			},
+			want: "-i in.mp4 out.mp4",
+		},
+		{
+			name: "every part in order",
+			command: Command{
+				Overwrite: true,
+				Options:   []string{"-hide_banner", "-nostdin"},
+				Inputs: []Input{
+					{Path: "in.mp4", Seek: 1.5, To: 4, Format: "mp4", Options: []string{"-noaccurate_seek"}},
+					{Path: "list.txt", Format: "concat", Options: []string{"-safe", "0"}},
+				},
+				Graph: &graph,
+				Outputs: []Output{{
+					Path:    "out.mp4",
+					Maps:    []Map{MapLabel("v"), MapStream("0:a?")},
+					Codec:   "copy",
+					Format:  "mp4",
+					Options: []string{"-movflags", "+faststart"},
+				}},
+			},
+			want: "-hide_banner -nostdin -y" +
+				" -ss 1.500 -to 4.000 -f mp4 -noaccurate_seek -i in.mp4" +
+				" -f concat -safe 0 -i list.txt" +
+				" -filter_complex [0:v:0]scale=640:-2[v]" +
+				" -map [v] -map 0:a? -c copy -movflags +faststart -f mp4 out.mp4",
+		},
+		{
+			name: "empty graph",
+			command: Command{
+				Inputs:  []Input{{Path: "in.mp4"}},
+				Graph:   &FilterGraph{},
+				Outputs: []Output{{Path: "out.mp4", Maps: []Map{MapStream("0")}}},
+			},
+			want: "-i in.mp4 -map 0 out.mp4",
+		},
+		{
+			name: "several outputs",
+			command: Command{
+				Inputs: []Input{{Path: "in.mp4"}},
+				Outputs: []Output{
+					{Path: "video.mp4", Maps: []Map{MapStream("0:v")}, Codec: "copy"},
+					{Path: "audio.m4a", Maps: []Map{MapStream("0:a")}, Codec: "copy"},
+				},
+			},
+			want: "-i in.mp4 -map 0:v -c copy video.mp4 -map 0:a -c copy audio.m4a",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := strings.Join(test.command.Args(), " "); got != test.want {
+				t.Errorf("Args() = %s\nwant %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCommandString(t *testing.T) {
+	command := Command{
+		Inputs:  []Input{{Path: "my video.mp4"}},
+		Graph:   &FilterGraph{Chains: []Chain{{Inputs: []string{"0:v:0"}, Filters: []Filter{NewFilter("null")}, Outputs: []string{"v"}}}},
+		Outputs: []Output{{Path: "it's.mp4", Maps: []Map{MapLabel("v")}}},
+	}
+
+	want := `ffmpeg -i 'my video.mp4' -filter_complex '[0:v:0]null[v]' -map '[v]' 'it'\''s.mp4'`
+	if got := command.String(); got != want {
+		t.Errorf("String() = %s\nwant %s", got, want)
+	}
+}
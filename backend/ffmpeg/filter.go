@@ -0,0 +1,133 @@
+package ffmpeg
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Arg is a filter option. Positional options have an empty Key.
+type Arg struct {
+	Key   string
+	Value string
+}
+
+// Filter is a single filter of a chain, e.g. trim=start=1:end=2.
+type Filter struct {
+	Name string
+	Args []Arg
+}
+
+// NewFilter returns the filter name with the given positional options.
+func NewFilter(name string, positional ...string) Filter {
+	filter := Filter{Name: name}
+	for _, value := range positional {
+		filter.Args = append(filter.Args, Arg{Value: value})
+	}
+	return filter
+}
+
+// With returns a copy of f with the option key set to value.
+func (f Filter) With(key, value string) Filter {
+	args := make([]Arg, len(f.Args), len(f.Args)+1)
+	copy(args, f.Args)
+	f.Args = append(args, Arg{Key: key, Value: value})
+	return f
+}
+
+// String returns the filter with its option values escaped, ready to be
+// embedded in a filter graph.
+func (f Filter) String() string {
+	if len(f.Args) == 0 {
+		return f.Name
+	}
+
+	args := make([]string, len(f.Args))
+	for i, arg := range f.Args {
+		value := escapeGraph(escapeOption(arg.Value))
+		if arg.Key != "" {
+			value = arg.Key + "=" + value
+		}
+		args[i] = value
+	}
+	return f.Name + "=" + strings.Join(args, ":")
+}
+
+// escapeOption escapes a value for the option parser of a filter.
+func escapeOption(value string) string {
+	return escape(value, `\':`)
+}
+
+// escapeGraph escapes a filter description for the filter graph parser.
+func escapeGraph(value string) string {
+	return escape(value, `\'[],;`)
+}
+
+func escape(value, special string) string {
+	if !strings.ContainsAny(value, special) {
+		return value
+	}
+
+	var escaped strings.Builder
+	for _, r := range value {
+		if strings.ContainsRune(special, r) {
+			escaped.WriteByte('\\')
+		}
+		escaped.WriteRune(r)
+	}
+	return escaped.String()
+}
+
+// Chain is a sequence of filters reading from the Inputs labels and
+// writing to the Outputs labels. Labels are given without brackets and may
+// also be stream specifiers such as "0:v:0".
+type Chain struct {
+	Inputs  []string
+	Filters []Filter
+	Outputs []string
+}
+
+func (c Chain) String() string {
+	var chain strings.Builder
+	for _, label := range c.Inputs {
+		chain.WriteString("[" + label + "]")
+	}
+
+	filters := make([]string, len(c.Filters))
+	for i, filter := range c.Filters {
+		filters[i] = filter.String()
+	}
+	chain.WriteString(strings.Join(filters, ","))
+
+	for _, label := range c.Outputs {
+		chain.WriteString("[" + label + "]")
+	}
+	return chain.String()
+}
+
+// FilterGraph is the value of -filter_complex.
+type FilterGraph struct {
+	Chains []Chain
+}
+
+// Add appends a chain of filters from inputs to outputs.
+func (g *FilterGraph) Add(inputs []string, outputs []string, filters ...Filter) {
+	g.Chains = append(g.Chains, Chain{Inputs: inputs, Filters: filters, Outputs: outputs})
+}
+
+func (g *FilterGraph) String() string {
+	chains := make([]string, len(g.Chains))
+	for i, chain := range g.Chains {
+		chains[i] = chain.String()
+	}
+	return strings.Join(chains, ";")
+}
+
+// Seconds formats a duration in seconds as a filter or option value.
+func Seconds(seconds float64) string {
+	return strconv.FormatFloat(seconds, 'f', 3, 64)
+}
+
+// Float formats a number as a filter or option value.
+func Float(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
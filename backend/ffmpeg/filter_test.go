@@ -0,0 +1,74 @@
+package ffmpeg
+
+import "testing"
+
+func TestFilterString(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter Filter
+		want   string
+	}{
+		{"no options", NewFilter("anull"), "anull"},
+		{"positional", NewFilter("crop", "640", "360", "0", "0"), "crop=640:360:0:0"},
+		{"named", NewFilter("trim").With("start", "1.000").With("end", "2.000"), "trim=start=1.000:end=2.000"},
+		{"positional then named", NewFilter("scale", "640", "-2").With("flags", "lanczos"), "scale=640:-2:flags=lanczos"},
+		// escaped once for the option parser, then again for the graph
+		{"colon", NewFilter("drawtext").With("text", "a:b"), `drawtext=text=a\\:b`},
+		{"comma", NewFilter("drawtext").With("text", "a,b"), `drawtext=text=a\,b`},
+		{"brackets", NewFilter("drawtext").With("text", "[x]"), `drawtext=text=\[x\]`},
+		{"semicolon", NewFilter("drawtext").With("text", "a;b"), `drawtext=text=a\;b`},
+		{"quote", NewFilter("drawtext").With("text", "it's"), `drawtext=text=it\\\'s`},
+		{"backslash", NewFilter("subtitles", `C:\subs.srt`), `subtitles=C\\:\\\\subs.srt`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.filter.String(); got != test.want {
+				t.Errorf("String() = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFilterWithCopies(t *testing.T) {
+	base := NewFilter("trim", "1")
+	a := base.With("end", "2")
+	b := base.With("end", "3")
+
+	if got := base.String(); got != "trim=1" {
+		t.Errorf("base = %s, want trim=1", got)
+	}
+	if got := a.String(); got != "trim=1:end=2" {
+		t.Errorf("a = %s, want trim=1:end=2", got)
+	}
+	if got := b.String(); got != "trim=1:end=3" {
+		t.Errorf("b = %s, want trim=1:end=3", got)
+	}
+}
+
+func TestFilterGraphString(t *testing.T) {
+	var graph FilterGraph
+	graph.Add([]string{"0:v:0"}, []string{"v0", "v1"}, NewFilter("split"))
+	graph.Add([]string{"v0"}, []string{"a"},
+		NewFilter("trim").With("end", "5.000"),
+		NewFilter("setpts", "PTS-STARTPTS"))
+	graph.Add([]string{"v1"}, []string{"b"},
+		NewFilter("trim").With("start", "5.000"),
+		NewFilter("setpts", "(PTS-STARTPTS)/2"))
+	graph.Add([]string{"a", "b"}, []string{"out"}, NewFilter("concat").With("n", "2").With("v", "1").With("a", "0"))
+
+	want := "[0:v:0]split[v0][v1];" +
+		"[v0]trim=end=5.000,setpts=PTS-STARTPTS[a];" +
+		"[v1]trim=start=5.000,setpts=(PTS-STARTPTS)/2[b];" +
+		"[a][b]concat=n=2:v=1:a=0[out]"
+	if got := graph.String(); got != want {
+		t.Errorf("String() = %s\nwant %s", got, want)
+	}
+}
+
+func TestChainWithoutLabels(t *testing.T) {
+	chain := Chain{Filters: []Filter{NewFilter("anullsrc"), NewFilter("atrim").With("end", "1.000")}}
+	if got, want := chain.String(), "anullsrc,atrim=end=1.000"; got != want {
+		t.Errorf("String() = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,172 @@
+package ffmpeg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"veedeo/config"
+)
+
+// ErrBusy is returned when the limiter queue is full.
+var ErrBusy = errors.New("too many ffmpeg processes queued")
+
+// Limits are the resource limits applied to every ffmpeg process, zero
+// means unlimited. They are only enforced on Linux.
+type Limits struct {
+	// MemoryMB caps the data segment of the process, its heap and other
+	// private writable mappings such as the stacks of its threads.
+	MemoryMB int
+	// CPUSeconds caps the CPU time, the process is killed past it.
+	CPUSeconds int
+}
+
+// Limiter bounds how many ffmpeg processes run at once. Callers beyond
+// MaxRunning wait in a queue of at most MaxQueue, in arrival order.
+type Limiter struct {
+	MaxRunning int
+	MaxQueue   int
+	Limits     Limits
+
+	mutex   sync.Mutex
+	running int
+	waiting []*waiter
+}
+
+type waiter struct {
+	ready      chan struct{}
+	onPosition func(int)
+}
+
+// NewLimiter returns a limiter running at most maxRunning processes with
+// maxQueue more waiting.
+func NewLimiter(maxRunning, maxQueue int, limits Limits) *Limiter {
+	return &Limiter{MaxRunning: max(1, maxRunning), MaxQueue: max(0, maxQueue), Limits: limits}
+}
+
+var (
+	defaultLimiter     *Limiter
+	defaultLimiterOnce sync.Once
+)
+
+// DefaultLimiter returns the limiter shared by all commands, configured by
+// the ffmpeg section of the configuration. It is created on first use, so
+// that the configuration is loaded by then.
+func DefaultLimiter() *Limiter {
+	defaultLimiterOnce.Do(func() {
+		cfg := config.Current().FFmpeg
+		defaultLimiter = NewLimiter(cfg.MaxConcurrent, cfg.MaxQueue, Limits{
+			MemoryMB:   cfg.MaxMemoryMB,
+			CPUSeconds: cfg.MaxCPUSeconds,
+		})
+	})
+	return defaultLimiter
+}
+
+type admittedKey struct{}
+
+// Admitted returns a copy of ctx for work already admitted by another queue,
+// such as the job queue. Its commands wait for a slot however many callers
+// are waiting instead of failing with ErrBusy, and don't report their
+// position in the limiter queue.
+func Admitted(ctx context.Context) context.Context {
+	return context.WithValue(ctx, admittedKey{}, true)
+}
+
+func admitted(ctx context.Context) bool {
+	ok, _ := ctx.Value(admittedKey{}).(bool)
+	return ok
+}
+
+// Full reports whether a new caller would be rejected with ErrBusy.
+func (l *Limiter) Full() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.running >= l.MaxRunning && len(l.waiting) >= l.MaxQueue
+}
+
+// Acquire waits for a free slot and returns the function releasing it.
+// While queued, onPosition, when not nil, is called with the 1-based
+// position in the queue each time it changes. It fails with ErrBusy when
+// the queue is full, unless ctx is Admitted, or with the context error if
+// ctx is done first.
+func (l *Limiter) Acquire(ctx context.Context, onPosition func(int)) (func(), error) {
+	l.mutex.Lock()
+	if l.running < l.MaxRunning && len(l.waiting) == 0 {
+		l.running++
+		l.mutex.Unlock()
+		return l.releaseFunc(), nil
+	}
+	if len(l.waiting) >= l.MaxQueue && !admitted(ctx) {
+		l.mutex.Unlock()
+		return nil, fmt.Errorf("%w: %d running, %d waiting", ErrBusy, l.running, len(l.waiting))
+	}
+
+	w := &waiter{ready: make(chan struct{}), onPosition: onPosition}
+	l.waiting = append(l.waiting, w)
+	position := len(l.waiting)
+	l.mutex.Unlock()
+
+	if onPosition != nil {
+		onPosition(position)
+	}
+
+	select {
+	case <-w.ready:
+		return l.releaseFunc(), nil
+	case <-ctx.Done():
+	}
+
+	l.mutex.Lock()
+	for i, other := range l.waiting {
+		if other == w {
+			l.waiting = append(l.waiting[:i], l.waiting[i+1:]...)
+			notify := l.positions()
+			l.mutex.Unlock()
+			notify()
+			return nil, ctx.Err()
+		}
+	}
+	l.mutex.Unlock()
+
+	// the slot was handed over while giving up, pass it on
+	l.releaseFunc()()
+	return nil, ctx.Err()
+}
+
+// releaseFunc returns a function freeing the slot once, handing it to the
+// first waiter if any.
+func (l *Limiter) releaseFunc() func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mutex.Lock()
+			if len(l.waiting) == 0 {
+				l.running--
+				l.mutex.Unlock()
+				return
+			}
+
+			next := l.waiting[0]
+			l.waiting = l.waiting[1:]
+			close(next.ready)
+			notify := l.positions()
+			l.mutex.Unlock()
+			notify()
+		})
+	}
+}
+
+// positions returns a function telling every waiter its current position,
+// to be called without holding the mutex.
+func (l *Limiter) positions() func() {
+	waiting := append([]*waiter{}, l.waiting...)
+	return func() {
+		for i, w := range waiting {
+			if w.onPosition != nil {
+				w.onPosition(i + 1)
+			}
+		}
+	}
+}
@@ -0,0 +1,35 @@
+//go:build linux
+
+package ffmpeg
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// limitedCommand returns the ffmpeg command running args under limits. A
+// shell sets them with ulimit then execs ffmpeg, so they hold from its first
+// instruction. The memory limit caps the data segment (RLIMIT_DATA) rather
+// than the address space, which also holds the shared libraries and the
+// unused reservations of the malloc arenas. Since Linux 4.7 the data
+// segment counts every private writable mapping, thread stacks included:
+// each ffmpeg thread takes its whole stack size, 8 MB by default, from the
+// limit whether it uses it or not, and the limit must leave room for them.
+func limitedCommand(ctx context.Context, limits Limits, args []string) *exec.Cmd {
+	var script []string
+	if limits.MemoryMB > 0 {
+		script = append(script, fmt.Sprintf("ulimit -d %d", limits.MemoryMB*1024))
+	}
+	if limits.CPUSeconds > 0 {
+		// killed with SIGXCPU once the CPU time is over
+		script = append(script, fmt.Sprintf("ulimit -t %d", limits.CPUSeconds))
+	}
+	if len(script) == 0 {
+		return exec.CommandContext(ctx, "ffmpeg", args...)
+	}
+
+	script = append(script, `exec ffmpeg "$@"`)
+	return exec.CommandContext(ctx, "sh", append([]string{"-c", strings.Join(script, " && "), "ffmpeg"}, args...)...)
+}
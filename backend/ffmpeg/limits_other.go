@@ -0,0 +1,14 @@
+//go:build !linux
+
+package ffmpeg
+
+import (
+	"context"
+	"os/exec"
+)
+
+// limitedCommand returns the ffmpeg command running args, the limits are
+// only enforced on Linux.
+func limitedCommand(ctx context.Context, limits Limits, args []string) *exec.Cmd {
+	return exec.CommandContext(ctx, "ffmpeg", args...)
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package ffmpeg
+
+import "os/exec"
+
+// KillProcessGroupOnCancel relies on exec.CommandContext killing the process.
+func KillProcessGroupOnCancel(cmd *exec.Cmd) {}
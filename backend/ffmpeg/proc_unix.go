@@ -0,0 +1,17 @@
+//go:build unix
+
+package ffmpeg
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// KillProcessGroupOnCancel runs cmd in its own process group and kills the
+// whole group when the command's context is done, so no child outlives it.
+func KillProcessGroupOnCancel(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -0,0 +1,93 @@
+package ffmpeg
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"strconv"
+	"strings"
+)
+
+// Progress is a progress report of a running ffmpeg command.
+type Progress struct {
+	// OutTime is how many seconds of output have been written.
+	OutTime float64
+	FPS     float64
+	// Speed is the processing speed relative to real time.
+	Speed float64
+	Done  bool
+	// Queued is the position in the DefaultLimiter queue while waiting to
+	// start, 0 once running or when the context is Admitted.
+	Queued int
+}
+
+// Run runs the command, reporting its progress to onProgress when not nil:
+// once when the process starts, then on every ffmpeg report. It first waits
+// for a slot of the DefaultLimiter, failing with ErrBusy when its queue is
+// full, and runs ffmpeg within the limiter's Limits. The process, and any
+// child it spawned, is killed when ctx is done. The returned bytes are
+// ffmpeg's stderr, useful to diagnose failures.
+func (c *Command) Run(ctx context.Context, onProgress func(Progress)) ([]byte, error) {
+	limiter := DefaultLimiter()
+	release, err := limiter.Acquire(ctx, func(position int) {
+		if onProgress != nil && !admitted(ctx) {
+			onProgress(Progress{Queued: position})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	args := append([]string{"-progress", "pipe:1", "-nostats"}, c.Args()...)
+	cmd := limitedCommand(ctx, limiter.Limits, args)
+	KillProcessGroupOnCancel(cmd)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	var progress Progress
+	if onProgress != nil {
+		onProgress(progress)
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+
+		switch key {
+		// despite the name, out_time_ms is expressed in microseconds too
+		case "out_time_us", "out_time_ms":
+			if outTime, err := strconv.ParseFloat(value, 64); err == nil {
+				progress.OutTime = outTime / 1e6
+			}
+		case "fps":
+			progress.FPS, _ = strconv.ParseFloat(value, 64)
+		case "speed":
+			progress.Speed, _ = strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64)
+		case "progress":
+			progress.Done = value == "end"
+			if onProgress != nil {
+				onProgress(progress)
+			}
+		}
+	}
+
+	if err := cmd.Wait(); err != nil {
+		return stderr.Bytes(), err
+	}
+
+	return stderr.Bytes(), nil
+}
@@ -0,0 +1,65 @@
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+func JobStatusHandler(w http.ResponseWriter, r *http.Request) {
+	job, ok := Default().Get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	state := job.State()
+	if _, ok := job.Result(); ok {
+		resultURL, err := Default().ResultURL(r.Context(), job)
+		if err != nil {
+			log.Printf("Error signing result of job %s: %v", job.ID, err)
+		}
+		state.ResultURL = resultURL
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state)
+}
+
+// JobResultHandler redirects to the signed link of the job result, which
+// supports ranges so downloads can be resumed.
+func JobResultHandler(w http.ResponseWriter, r *http.Request) {
+	job, ok := Default().Get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	if _, ok := job.Result(); !ok {
+		http.Error(w, "Job result not available", http.StatusConflict)
+		return
+	}
+
+	resultURL, err := Default().ResultURL(r.Context(), job)
+	if errors.Is(err, ErrExpired) {
+		http.Error(w, "Job result expired", http.StatusGone)
+		return
+	}
+	if err != nil {
+		log.Printf("Error signing result of job %s: %v", job.ID, err)
+		http.Error(w, "Failed to sign job result link", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, resultURL, http.StatusFound)
+}
+
+func JobCancelHandler(w http.ResponseWriter, r *http.Request) {
+	if !Default().Cancel(r.PathValue("id")) {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,502 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+	"veedeo/config"
+	"veedeo/events"
+	"veedeo/storage"
+)
+
+type Status string
+
+const (
+	StatusQueued   Status = "queued"
+	StatusRunning  Status = "running"
+	StatusDone     Status = "done"
+	StatusFailed   Status = "failed"
+	StatusCanceled Status = "canceled"
+)
+
+var (
+	ErrQueueFull    = errors.New("job queue is full")
+	ErrShuttingDown = errors.New("server is shutting down")
+	ErrExpired      = errors.New("job expired")
+)
+
+// Func does the actual work of a job and returns the path of its result,
+// which should live inside job.Dir. The result is then moved to the default
+// storage. Jobs producing no file return an empty path and may report their
+// outcome with SetOutput instead.
+type Func func(ctx context.Context, job *Job) (string, error)
+
+type Job struct {
+	ID  string
+	Dir string
+
+	fn     Func
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mutex      sync.Mutex
+	status     Status
+	err        string
+	result     string
+	outputs    map[string]string
+	createdAt  time.Time
+	finishedAt time.Time
+}
+
+// State is the JSON representation of a job returned by GET /jobs/{id}.
+type State struct {
+	ID         string     `json:"id"`
+	Status     Status     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	// ResultURL is a signed link to download the result of a done job.
+	ResultURL string            `json:"resultUrl,omitempty"`
+	Outputs   map[string]string `json:"outputs,omitempty"`
+}
+
+func (j *Job) State() State {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	state := State{
+		ID:        j.ID,
+		Status:    j.status,
+		Error:     j.err,
+		CreatedAt: j.createdAt,
+		Outputs:   maps.Clone(j.outputs),
+	}
+	if !j.finishedAt.IsZero() {
+		finishedAt := j.finishedAt
+		state.FinishedAt = &finishedAt
+	}
+
+	return state
+}
+
+// Result returns the storage key of the result once the job is done, if it
+// produced a file.
+func (j *Job) Result() (string, bool) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	return j.result, j.status == StatusDone && j.result != ""
+}
+
+// SetOutput records a value produced by the job, such as the ID of an
+// asset it created, returned in its state under outputs.
+func (j *Job) SetOutput(key, value string) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if j.outputs == nil {
+		j.outputs = make(map[string]string)
+	}
+	j.outputs[key] = value
+}
+
+func (j *Job) setStatus(status Status) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	j.status = status
+}
+
+// finish records the outcome of the job, it reports false if the job was
+// already finished.
+func (j *Job) finish(result string, err error) bool {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if !j.finishedAt.IsZero() {
+		return false
+	}
+
+	j.finishedAt = time.Now()
+	switch {
+	case j.ctx.Err() != nil:
+		j.status = StatusCanceled
+	case err != nil:
+		j.status = StatusFailed
+		j.err = err.Error()
+	default:
+		j.status = StatusDone
+		j.result = result
+	}
+	return true
+}
+
+func (j *Job) finished() bool {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	return !j.finishedAt.IsZero()
+}
+
+// expiresAt returns when a finished job expires, or the zero time if it is
+// still running.
+func (j *Job) expiresAt(ttl time.Duration) time.Time {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if j.finishedAt.IsZero() {
+		return time.Time{}
+	}
+	return j.finishedAt.Add(ttl)
+}
+
+func (j *Job) expired(ttl time.Duration) bool {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	return !j.finishedAt.IsZero() && time.Since(j.finishedAt) > ttl
+}
+
+// Manager runs jobs on a fixed pool of workers and keeps finished jobs
+// around for ttl so their results can be downloaded.
+type Manager struct {
+	jobs  map[string]*Job
+	queue chan *Job
+	// waiting are the queued jobs in order, to publish their position
+	waiting []*Job
+	ttl     time.Duration
+	mutex   sync.Mutex
+
+	// active counts the submitted jobs that have not finished running
+	active sync.WaitGroup
+	closed bool
+}
+
+// jobTTL is how long finished jobs and their results are kept.
+const jobTTL = 30 * time.Minute
+
+var (
+	defaultManager     *Manager
+	defaultManagerOnce sync.Once
+)
+
+// Default returns the manager shared by all handlers. It runs as many jobs
+// at once as ffmpeg processes are allowed and queues as many as the ffmpeg
+// queue takes, from the ffmpeg section of the configuration. It is created
+// on first use, so that the configuration is loaded by then.
+func Default() *Manager {
+	defaultManagerOnce.Do(func() {
+		cfg := config.Current().FFmpeg
+		defaultManager = NewManager(cfg.MaxConcurrent, cfg.MaxQueue, jobTTL)
+	})
+	return defaultManager
+}
+
+func NewManager(workers, queueSize int, ttl time.Duration) *Manager {
+	m := &Manager{
+		jobs:  make(map[string]*Job),
+		queue: make(chan *Job, queueSize),
+		ttl:   ttl,
+	}
+
+	for i := 0; i < workers; i++ {
+		go m.work()
+	}
+	go m.cleanup()
+
+	return m
+}
+
+// Submit queues fn to be run by a worker. The job takes ownership of dir and
+// removes it once the job expires.
+func (m *Manager) Submit(dir string, fn Func) (*Job, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &Job{
+		ID:        events.NewJobID(),
+		Dir:       dir,
+		fn:        fn,
+		ctx:       ctx,
+		cancel:    cancel,
+		status:    StatusQueued,
+		createdAt: time.Now(),
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.closed {
+		cancel()
+		return nil, ErrShuttingDown
+	}
+
+	m.active.Add(1)
+	select {
+	case m.queue <- job:
+	default:
+		m.active.Done()
+		cancel()
+		return nil, ErrQueueFull
+	}
+	m.jobs[job.ID] = job
+	m.waiting = append(m.waiting, job)
+	m.publishPositions(len(m.waiting) - 1)
+
+	return job, nil
+}
+
+// dequeue removes job from the waiting jobs, telling the ones behind it
+// their new position. The mutex must be held.
+func (m *Manager) dequeue(job *Job) {
+	i := slices.Index(m.waiting, job)
+	if i < 0 {
+		return
+	}
+	m.waiting = slices.Delete(m.waiting, i, i+1)
+	m.publishPositions(i)
+}
+
+// publishPositions publishes the queue position of the waiting jobs from
+// index from on. The mutex must be held.
+func (m *Manager) publishPositions(from int) {
+	for i := from; i < len(m.waiting); i++ {
+		events.SseManager.UpdateProgress(m.waiting[i].ID, events.Progress{Stage: string(StatusQueued), Queue: i + 1})
+	}
+}
+
+// shutdownGrace is how long canceled jobs get to stop once the shutdown
+// deadline is over.
+const shutdownGrace = 10 * time.Second
+
+// Shutdown stops accepting jobs and waits for the queued and running ones
+// to finish. When ctx is done first, the remaining jobs are canceled, which
+// kills their processes. The working directories are then removed, while
+// the stored results stay available to the status and result routes.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.mutex.Lock()
+	m.closed = true
+	m.mutex.Unlock()
+
+	err := m.wait(ctx)
+	if err != nil {
+		m.mutex.Lock()
+		for _, job := range m.jobs {
+			if !job.finished() {
+				log.Printf("Killing job %s", job.ID)
+				job.cancel()
+			}
+		}
+		m.mutex.Unlock()
+
+		grace, cancel := context.WithTimeout(context.Background(), shutdownGrace)
+		defer cancel()
+		if err := m.wait(grace); err != nil {
+			log.Println("Some jobs did not stop in time")
+		}
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, job := range m.jobs {
+		removeJobDir(job)
+	}
+	return err
+}
+
+// ShuttingDown reports whether Shutdown was called, new work should then be
+// refused.
+func (m *Manager) ShuttingDown() bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.closed
+}
+
+// wait waits for every submitted job to have run, or for ctx to be done.
+func (m *Manager) wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		m.active.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ResultURL returns a signed link to the result of job, valid until the
+// job expires and its result is deleted.
+func (m *Manager) ResultURL(ctx context.Context, job *Job) (string, error) {
+	result, ok := job.Result()
+	if !ok {
+		return "", fmt.Errorf("job %s has no result", job.ID)
+	}
+
+	remaining := time.Until(job.expiresAt(m.ttl)).Truncate(time.Second)
+	if remaining <= 0 {
+		return "", fmt.Errorf("job %s: %w", job.ID, ErrExpired)
+	}
+	return storage.Default().PresignGet(ctx, result, remaining)
+}
+
+func (m *Manager) Get(id string) (*Job, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	job, ok := m.jobs[id]
+	return job, ok
+}
+
+// Cancel stops job id, killing its running processes, and removes its
+// directory. Finished jobs are forgotten right away, while active ones stay
+// visible as canceled until they expire.
+func (m *Manager) Cancel(id string) bool {
+	m.mutex.Lock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		m.mutex.Unlock()
+		return false
+	}
+
+	if job.finished() {
+		events.SseManager.Forget(id)
+		delete(m.jobs, id)
+		m.mutex.Unlock()
+
+		// the result may be on a remote storage, don't block the others
+		removeJobFiles(job)
+		return true
+	}
+	defer m.mutex.Unlock()
+
+	job.cancel()
+	if job.State().Status == StatusQueued {
+		m.dequeue(job)
+		m.finishCanceled(job)
+	}
+	return true
+}
+
+func (m *Manager) work() {
+	for job := range m.queue {
+		m.run(job)
+	}
+}
+
+func (m *Manager) run(job *Job) {
+	defer m.active.Done()
+	defer job.cancel()
+
+	m.mutex.Lock()
+	m.dequeue(job)
+	m.mutex.Unlock()
+
+	// canceled while still in the queue
+	if job.ctx.Err() != nil {
+		m.finishCanceled(job)
+		return
+	}
+
+	job.setStatus(StatusRunning)
+	events.SseManager.UpdateProgress(job.ID, events.Progress{Stage: string(StatusRunning)})
+
+	result, err := job.fn(job.ctx, job)
+	if err == nil && result != "" {
+		result, err = storeResult(job, result)
+	}
+	if job.ctx.Err() != nil {
+		m.finishCanceled(job)
+		return
+	}
+	job.finish(result, err)
+
+	if err != nil {
+		log.Printf("Job %s failed: %v", job.ID, err)
+		events.SseManager.UpdateProgress(job.ID, events.Progress{Stage: string(StatusFailed)})
+		return
+	}
+	events.SseManager.UpdateProgress(job.ID, events.Progress{Stage: string(StatusDone), Percent: 100})
+}
+
+func (m *Manager) finishCanceled(job *Job) {
+	if !job.finish("", nil) {
+		return
+	}
+	removeJobDir(job)
+	log.Printf("Job %s canceled", job.ID)
+	events.SseManager.UpdateProgress(job.ID, events.Progress{Stage: string(StatusCanceled)})
+}
+
+// resultContentTypes are the content types of the results, by extension.
+var resultContentTypes = map[string]string{
+	".mp4":  "video/mp4",
+	".mov":  "video/quicktime",
+	".webm": "video/webm",
+	".mkv":  "video/x-matroska",
+}
+
+// storeResult moves the result file at path to the default storage, under
+// results/<job id>/processed-video<ext>, and returns its key. The job directory is no longer
+// needed afterwards and is removed.
+func storeResult(job *Job, path string) (string, error) {
+	key := "results/" + job.ID + "/processed-video" + filepath.Ext(path)
+	err := storage.Upload(job.ctx, storage.Default(), path, key, resultContentTypes[filepath.Ext(path)])
+	if err != nil {
+		return "", fmt.Errorf("failed to store result: %w", err)
+	}
+
+	removeJobDir(job)
+	return key, nil
+}
+
+// removeJobFiles removes the directory and the stored result of job.
+func removeJobFiles(job *Job) {
+	removeJobDir(job)
+
+	if result, ok := job.Result(); ok {
+		if err := storage.Default().Delete(context.Background(), result); err != nil {
+			log.Printf("Error removing job result %s: %v", result, err)
+		}
+	}
+}
+
+func removeJobDir(job *Job) {
+	if err := os.RemoveAll(job.Dir); err != nil {
+		log.Printf("Error removing job directory %s: %v", job.Dir, err)
+	}
+}
+
+func (m *Manager) cleanup() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		var expired []*Job
+		m.mutex.Lock()
+		for id, job := range m.jobs {
+			if !job.expired(m.ttl) {
+				continue
+			}
+			expired = append(expired, job)
+			events.SseManager.Forget(id)
+			delete(m.jobs, id)
+		}
+		m.mutex.Unlock()
+
+		for _, job := range expired {
+			removeJobFiles(job)
+		}
+	}
+}
@@ -1,46 +1,155 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	"veedeo/assets"
+	"veedeo/config"
 	"veedeo/events"
+	"veedeo/jobs"
+	"veedeo/storage"
+	"veedeo/uploads"
 	"veedeo/video"
 
-	"github.com/joho/godotenv"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/cors"
 )
 
 func main() {
-	h := setupServerHandler()
+	cfg, printConfig, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if printConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	config.Set(cfg)
+
+	storageCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	store, err := storage.New(storageCtx, cfg)
+	cancel()
+	if err != nil {
+		log.Fatalf("Error setting up %s storage: %v", cfg.Storage.Backend, err)
+	}
+	storage.SetDefault(store)
+
+	// request contexts are canceled once the shutdown deadline is over
+	requestsCtx, cancelRequests := context.WithCancel(context.Background())
+	server := &http.Server{
+		Addr:        cfg.Addr,
+		Handler:     setupServerHandler(cfg),
+		BaseContext: func(net.Listener) context.Context { return requestsCtx },
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("Server starting on %s...", cfg.Addr)
+		serveErr <- server.ListenAndServe()
+	}()
 
-	log.Println("Server starting on :8080...")
-	if err := http.ListenAndServe(":8080", h); err != nil {
+	select {
+	case err := <-serveErr:
 		log.Fatal(err)
+	case <-ctx.Done():
 	}
+	// a second signal kills the server right away
+	stop()
+
+	shutdown(server, cfg.ShutdownTimeout, cancelRequests)
 }
 
-func setupServerHandler() http.Handler {
-	env := os.Getenv("APP_ENV")
-	if env != "PROD" {
-		err := godotenv.Load()
-		if err != nil {
-			log.Println("Error loading .env file!")
+// shutdownGrace is the least time given to the running requests once the
+// jobs are over, and how long killed requests get to clean up after
+// themselves.
+const shutdownGrace = 5 * time.Second
+
+// shutdown stops accepting jobs and waits for the queued and running ones
+// until timeout, killing those left. The server keeps serving meanwhile, so
+// that clients follow their jobs and fetch the results. The SSE streams are
+// then ended and the server waits for the running requests before closing,
+// after which the uploads and assets are removed.
+func shutdown(server *http.Server, timeout time.Duration, cancelRequests context.CancelFunc) {
+	log.Printf("Shutting down, waiting up to %s for running jobs...", timeout)
+
+	deadline := time.Now().Add(timeout)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	if err := jobs.Default().Shutdown(ctx); err != nil {
+		log.Println("Killed the remaining jobs:", err)
+	}
+
+	events.SseManager.Shutdown()
+
+	serverCtx, cancel := context.WithTimeout(context.Background(), max(time.Until(deadline), shutdownGrace))
+	defer cancel()
+	if err := server.Shutdown(serverCtx); err != nil {
+		log.Println("Killing the running requests:", err)
+		cancelRequests()
+
+		grace, cancel := context.WithTimeout(context.Background(), shutdownGrace)
+		defer cancel()
+		if err := server.Shutdown(grace); err != nil {
+			server.Close()
 		}
-	} else {
-		log.Println("Running in production mode, skipping .env file")
 	}
 
+	// the results are kept for the URLs handed out to clients, the uploads
+	// and assets would only be orphaned by the restart
+	uploads.UploadStore.Clear()
+	assets.AssetStore.Clear()
+
+	log.Println("Server stopped")
+}
+
+func setupServerHandler(cfg *config.Config) http.Handler {
 	c := cors.New(cors.Options{
-		AllowedOrigins: []string{"http://localhost:9000", "https://vvvdeo.pages.dev", "https://vvvdeo.com", "http://localhost:5173", "http://localhost:5174", "https://api.vvvdeo.com"},
-		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedOrigins: cfg.CORS.AllowedOrigins,
+		AllowedMethods: []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders: []string{
 			"Accept",
 			"Authorization",
 			"Content-Type",
 			"X-CSRF-Token",
 			"X-Requested-With",
+			"Tus-Resumable",
+			"Upload-Length",
+			"Upload-Offset",
+			"Upload-Metadata",
+			"Range",
+		},
+		ExposedHeaders: []string{
+			"X-Job-ID",
+			"Location",
+			"Retry-After",
+			"Tus-Resumable",
+			"Tus-Version",
+			"Tus-Extension",
+			"Tus-Max-Size",
+			"Upload-Offset",
+			"Upload-Length",
+			"Upload-Expires",
+			"Content-Length",
+			"Content-Range",
+			"Accept-Ranges",
 		},
 		AllowCredentials: true,
 	})
@@ -49,7 +158,25 @@ func setupServerHandler() http.Handler {
 
 	mux.HandleFunc("/video/local-inference", video.VideoLocalInferenceHandler)
 	mux.HandleFunc("/video/speedup", video.VideoSpeedupHandler)
+	mux.HandleFunc("POST /video/trim", video.VideoTrimHandler)
+	mux.HandleFunc("POST /video/edit", video.VideoEditHandler)
+	mux.HandleFunc("POST /video/probe", video.VideoProbeHandler)
+	mux.HandleFunc("POST /video/import", video.VideoImportHandler)
+	mux.HandleFunc("POST /video/import/cobalt", video.VideoCobaltImportHandler)
+	mux.HandleFunc("POST /video/import/url", video.VideoURLImportHandler)
 	mux.HandleFunc("/ffmpeg-events", events.FfmpegEventsHandler)
+	mux.HandleFunc("GET /jobs/{id}", jobs.JobStatusHandler)
+	mux.HandleFunc("GET /jobs/{id}/result", jobs.JobResultHandler)
+	mux.HandleFunc("DELETE /jobs/{id}", jobs.JobCancelHandler)
+	mux.HandleFunc("OPTIONS /uploads", uploads.UploadOptionsHandler)
+	mux.HandleFunc("POST /uploads", uploads.UploadCreateHandler)
+	mux.HandleFunc("HEAD /uploads/{id}", uploads.UploadHeadHandler)
+	mux.HandleFunc("PATCH /uploads/{id}", uploads.UploadPatchHandler)
+	mux.HandleFunc("DELETE /uploads/{id}", uploads.UploadDeleteHandler)
+	mux.HandleFunc("POST /assets", video.VideoAssetHandler)
+	mux.HandleFunc("GET /assets/{id}", assets.AssetHandler)
+	mux.HandleFunc("DELETE /assets/{id}", assets.AssetDeleteHandler)
+	mux.HandleFunc("GET "+storage.DownloadPath+"{key...}", storage.DownloadHandler)
 	mux.Handle("/metrics", promhttp.Handler())
 
 	return c.Handler(mux)
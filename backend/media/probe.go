@@ -0,0 +1,211 @@
+package media
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Info describes a media file as reported by ffprobe.
+type Info struct {
+	Format   Format   `json:"format"`
+	Streams  []Stream `json:"streams"`
+	Duration float64  `json:"duration"`
+	// Rotation in degrees of the first video stream, in [0, 360).
+	Rotation int `json:"rotation"`
+}
+
+type Format struct {
+	// Name is the comma separated list of demuxer names, e.g. "mov,mp4,m4a,3gp,3g2,mj2".
+	Name     string            `json:"name"`
+	LongName string            `json:"longName"`
+	Duration float64           `json:"duration"`
+	Size     int64             `json:"size"`
+	BitRate  int64             `json:"bitRate"`
+	Tags     map[string]string `json:"tags,omitempty"`
+}
+
+type Stream struct {
+	Index       int     `json:"index"`
+	Type        string  `json:"type"`
+	Codec       string  `json:"codec"`
+	Profile     string  `json:"profile,omitempty"`
+	Duration    float64 `json:"duration,omitempty"`
+	Width       int     `json:"width,omitempty"`
+	Height      int     `json:"height,omitempty"`
+	FrameRate   float64 `json:"frameRate,omitempty"`
+	PixelFormat string  `json:"pixelFormat,omitempty"`
+	Rotation    int     `json:"rotation,omitempty"`
+	SampleRate  int     `json:"sampleRate,omitempty"`
+	Channels    int     `json:"channels,omitempty"`
+	Language    string  `json:"language,omitempty"`
+}
+
+const (
+	StreamVideo = "video"
+	StreamAudio = "audio"
+)
+
+// Video returns the first video stream.
+func (i *Info) Video() (Stream, bool) {
+	for _, stream := range i.Streams {
+		if stream.Type == StreamVideo {
+			return stream, true
+		}
+	}
+	return Stream{}, false
+}
+
+// AudioStreams returns the audio streams in input order.
+func (i *Info) AudioStreams() []Stream {
+	var streams []Stream
+	for _, stream := range i.Streams {
+		if stream.Type == StreamAudio {
+			streams = append(streams, stream)
+		}
+	}
+	return streams
+}
+
+// ffprobe -print_format json output, numbers are mostly reported as strings.
+type probeOutput struct {
+	Format struct {
+		FormatName     string            `json:"format_name"`
+		FormatLongName string            `json:"format_long_name"`
+		Duration       string            `json:"duration"`
+		Size           string            `json:"size"`
+		BitRate        string            `json:"bit_rate"`
+		Tags           map[string]string `json:"tags"`
+	} `json:"format"`
+	Streams []struct {
+		Index        int               `json:"index"`
+		CodecType    string            `json:"codec_type"`
+		CodecName    string            `json:"codec_name"`
+		Profile      string            `json:"profile"`
+		Duration     string            `json:"duration"`
+		Width        int               `json:"width"`
+		Height       int               `json:"height"`
+		AvgFrameRate string            `json:"avg_frame_rate"`
+		RFrameRate   string            `json:"r_frame_rate"`
+		PixFmt       string            `json:"pix_fmt"`
+		SampleRate   string            `json:"sample_rate"`
+		Channels     int               `json:"channels"`
+		Tags         map[string]string `json:"tags"`
+		SideDataList []struct {
+			Rotation *float64 `json:"rotation"`
+		} `json:"side_data_list"`
+	} `json:"streams"`
+}
+
+// Probe runs ffprobe on the media at path.
+func Probe(ctx context.Context, path string) (*Info, error) {
+	cmd := exec.CommandContext(ctx, "ffprobe",
+		"-v", "error",
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+		path)
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to probe media: %w", err)
+	}
+
+	var probe probeOutput
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return nil, fmt.Errorf("failed to decode ffprobe output: %w", err)
+	}
+
+	info := &Info{
+		Format: Format{
+			Name:     probe.Format.FormatName,
+			LongName: probe.Format.FormatLongName,
+			Duration: parseFloat(probe.Format.Duration),
+			Size:     int64(parseFloat(probe.Format.Size)),
+			BitRate:  int64(parseFloat(probe.Format.BitRate)),
+			Tags:     probe.Format.Tags,
+		},
+	}
+	info.Duration = info.Format.Duration
+
+	for _, s := range probe.Streams {
+		stream := Stream{
+			Index:       s.Index,
+			Type:        s.CodecType,
+			Codec:       s.CodecName,
+			Profile:     s.Profile,
+			Duration:    parseFloat(s.Duration),
+			Width:       s.Width,
+			Height:      s.Height,
+			PixelFormat: s.PixFmt,
+			SampleRate:  int(parseFloat(s.SampleRate)),
+			Channels:    s.Channels,
+			Language:    s.Tags["language"],
+		}
+
+		if s.CodecType == StreamVideo {
+			stream.FrameRate = parseRate(s.AvgFrameRate)
+			if stream.FrameRate == 0 {
+				stream.FrameRate = parseRate(s.RFrameRate)
+			}
+
+			// newer ffprobe reports the display matrix, older ones a tag
+			rotation := parseFloat(s.Tags["rotate"])
+			for _, sideData := range s.SideDataList {
+				if sideData.Rotation != nil {
+					rotation = *sideData.Rotation
+				}
+			}
+			stream.Rotation = normalizeRotation(rotation)
+		}
+
+		info.Streams = append(info.Streams, stream)
+	}
+
+	// raw streams may lack a container duration, use the longest stream
+	if info.Duration == 0 {
+		for _, stream := range info.Streams {
+			info.Duration = math.Max(info.Duration, stream.Duration)
+		}
+	}
+
+	if video, ok := info.Video(); ok {
+		info.Rotation = video.Rotation
+	}
+
+	return info, nil
+}
+
+func parseFloat(value string) float64 {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
+	}
+	return f
+}
+
+// parseRate parses ffprobe rationals like "30000/1001".
+func parseRate(rate string) float64 {
+	num, den, ok := strings.Cut(rate, "/")
+	if !ok {
+		return parseFloat(rate)
+	}
+
+	d := parseFloat(den)
+	if d == 0 {
+		return 0
+	}
+	return parseFloat(num) / d
+}
+
+func normalizeRotation(degrees float64) int {
+	rotation := int(math.Round(degrees)) % 360
+	if rotation < 0 {
+		rotation += 360
+	}
+	return rotation
+}
@@ -0,0 +1,160 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"veedeo/config"
+)
+
+// Containers recognized by Sniff.
+const (
+	ContainerMP4  = "mp4"
+	ContainerMOV  = "mov"
+	ContainerWebM = "webm"
+	ContainerMKV  = "mkv"
+)
+
+// ErrUnsupported is returned, wrapped with the reason, for media that is not
+// recognized or not allowed.
+var ErrUnsupported = errors.New("unsupported media")
+
+// sniffLen is how much of the file is read to detect its container.
+const sniffLen = 512
+
+var ebmlMagic = []byte{0x1a, 0x45, 0xdf, 0xa3}
+
+// Sniff detects the container of the file at path from its magic bytes.
+func Sniff(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	header := make([]byte, sniffLen)
+	n, err := io.ReadFull(file, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", fmt.Errorf("%w: file too short", ErrUnsupported)
+	}
+	header = header[:n]
+
+	return SniffHeader(header)
+}
+
+// SniffHeader detects the container from the first bytes of a file, at
+// least 12 are needed.
+func SniffHeader(header []byte) (string, error) {
+	if container, ok := sniffHeader(header); ok {
+		return container, nil
+	}
+	return "", fmt.Errorf("%w: unknown container", ErrUnsupported)
+}
+
+func sniffHeader(header []byte) (string, bool) {
+	// ISO base media files start with a box: 4 bytes of size then its type
+	if len(header) >= 12 {
+		switch string(header[4:8]) {
+		case "ftyp":
+			if string(header[8:12]) == "qt  " {
+				return ContainerMOV, true
+			}
+			return ContainerMP4, true
+		// old QuickTime files may start straight with one of these atoms
+		case "moov", "mdat", "wide", "free", "skip":
+			return ContainerMOV, true
+		}
+	}
+
+	// Matroska and WebM share the EBML header, the doctype tells them apart
+	if bytes.HasPrefix(header, ebmlMagic) {
+		if bytes.Contains(header, []byte("webm")) {
+			return ContainerWebM, true
+		}
+		if bytes.Contains(header, []byte("matroska")) {
+			return ContainerMKV, true
+		}
+	}
+
+	return "", false
+}
+
+// formatNames maps each container to the ffprobe demuxer that reads it.
+var formatNames = map[string]string{
+	ContainerMP4:  "mp4",
+	ContainerMOV:  "mov",
+	ContainerWebM: "webm",
+	ContainerMKV:  "matroska",
+}
+
+// Allowlist lists the containers and codecs accepted for uploads.
+type Allowlist struct {
+	Containers  []string
+	VideoCodecs []string
+	AudioCodecs []string
+}
+
+// DefaultAllowlist returns the allowlist of the media section of the
+// configuration.
+func DefaultAllowlist() Allowlist {
+	cfg := config.Current().Media
+	return Allowlist{
+		Containers:  lower(cfg.AllowedContainers),
+		VideoCodecs: lower(cfg.AllowedVideoCodecs),
+		AudioCodecs: lower(cfg.AllowedAudioCodecs),
+	}
+}
+
+func lower(list []string) []string {
+	lowered := make([]string, len(list))
+	for i, item := range list {
+		lowered[i] = strings.ToLower(item)
+	}
+	return lowered
+}
+
+// Check validates the file at path against the allowlist, first from its
+// magic bytes then from what ffprobe detects, and returns its probe info.
+// Errors wrapping ErrUnsupported describe why the media was rejected.
+func (a Allowlist) Check(ctx context.Context, path string) (*Info, error) {
+	container, err := Sniff(path)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(a.Containers, container) {
+		return nil, fmt.Errorf("%w: %s container is not allowed", ErrUnsupported, container)
+	}
+
+	info, err := Probe(ctx, path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+
+	demuxers := strings.Split(info.Format.Name, ",")
+	if !slices.Contains(demuxers, formatNames[container]) {
+		return nil, fmt.Errorf("%w: %s file detected as %s", ErrUnsupported, container, info.Format.Name)
+	}
+
+	video, ok := info.Video()
+	if !ok {
+		return nil, fmt.Errorf("%w: no video stream", ErrUnsupported)
+	}
+	if !slices.Contains(a.VideoCodecs, video.Codec) {
+		return nil, fmt.Errorf("%w: %s video codec is not allowed", ErrUnsupported, video.Codec)
+	}
+	if video.Width <= 0 || video.Height <= 0 {
+		return nil, fmt.Errorf("%w: %dx%d video stream", ErrUnsupported, video.Width, video.Height)
+	}
+	for _, audio := range info.AudioStreams() {
+		if !slices.Contains(a.AudioCodecs, audio.Codec) {
+			return nil, fmt.Errorf("%w: %s audio codec is not allowed", ErrUnsupported, audio.Codec)
+		}
+	}
+
+	return info, nil
+}
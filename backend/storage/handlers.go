@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"path"
+)
+
+// DownloadPath is where DownloadHandler is mounted.
+const DownloadPath = "/files/"
+
+// DownloadHandler serves the objects of the local storage through the links
+// returned by PresignGet, with support for ranges.
+func DownloadHandler(w http.ResponseWriter, r *http.Request) {
+	local, ok := Default().(*Local)
+	if !ok {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	key := r.PathValue("key")
+	query := r.URL.Query()
+	err := local.verify(key, query.Get("expires"), query.Get("signature"))
+	if errors.Is(err, errExpiredLink) {
+		http.Error(w, "Link expired", http.StatusGone)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Invalid link", http.StatusForbidden)
+		return
+	}
+
+	file, object, err := local.Get(r.Context(), key)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error opening %s: %v", key, err)
+		http.Error(w, "Failed to open file", http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	name := path.Base(key)
+	w.Header().Set("Content-Disposition", "attachment; filename="+name)
+	if object.ContentType != "" {
+		w.Header().Set("Content-Type", object.ContentType)
+	}
+	http.ServeContent(w, r, name, object.ModTime, file.(io.ReadSeeker))
+}
@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	errInvalidSignature = errors.New("invalid signature")
+	errExpiredLink      = errors.New("link expired")
+)
+
+// Local stores objects as files under a root directory. Its presigned URLs
+// are signed with signingKey and served by DownloadHandler.
+type Local struct {
+	root       string
+	signingKey []byte
+}
+
+// NewLocal returns the storage of the root directory. Without a signing
+// key, a random one is used and links stop working on restart.
+func NewLocal(root string, signingKey []byte) (*Local, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+
+	if len(signingKey) == 0 {
+		signingKey = make([]byte, 32)
+		if _, err := rand.Read(signingKey); err != nil {
+			return nil, err
+		}
+		log.Println("No storage signing key set, download links won't survive a restart")
+	}
+
+	return &Local{root: filepath.Clean(root), signingKey: signingKey}, nil
+}
+
+func (l *Local) path(key string) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(l.root, filepath.FromSlash(key)), nil
+}
+
+// Put writes to a temporary file renamed once complete, so readers never
+// see a partial object.
+func (l *Local) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	dst, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(dst), ".put-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	_, err = io.Copy(file, r)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), dst)
+}
+
+func (l *Local) Get(ctx context.Context, key string) (io.ReadCloser, Object, error) {
+	object, err := l.Stat(ctx, key)
+	if err != nil {
+		return nil, Object{}, err
+	}
+
+	src, _ := l.path(key)
+	file, err := os.Open(src)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, Object{}, ErrNotFound
+	}
+	if err != nil {
+		return nil, Object{}, err
+	}
+	return file, object, nil
+}
+
+func (l *Local) Delete(ctx context.Context, key string) error {
+	src, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(src); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	// drop the directories left empty, up to the root
+	for dir := filepath.Dir(src); dir != l.root; dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+func (l *Local) Stat(ctx context.Context, key string) (Object, error) {
+	src, err := l.path(key)
+	if err != nil {
+		return Object{}, err
+	}
+
+	info, err := os.Stat(src)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && info.IsDir()) {
+		return Object{}, ErrNotFound
+	}
+	if err != nil {
+		return Object{}, err
+	}
+
+	return Object{
+		Key:         key,
+		Size:        info.Size(),
+		ModTime:     info.ModTime(),
+		ContentType: mime.TypeByExtension(path.Ext(key)),
+	}, nil
+}
+
+// PresignGet returns a link to DownloadHandler signed with HMAC-SHA256.
+func (l *Local) PresignGet(ctx context.Context, key string, expires time.Duration) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	expiresAt := strconv.FormatInt(time.Now().Add(expires).Unix(), 10)
+
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+
+	query := url.Values{}
+	query.Set("expires", expiresAt)
+	query.Set("signature", l.sign(key, expiresAt))
+	return DownloadPath + strings.Join(segments, "/") + "?" + query.Encode(), nil
+}
+
+func (l *Local) sign(key, expiresAt string) string {
+	mac := hmac.New(sha256.New, l.signingKey)
+	mac.Write([]byte(key + "\n" + expiresAt))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verify checks the signature of a link to key.
+func (l *Local) verify(key, expiresAt, signature string) error {
+	expected, err := hex.DecodeString(l.sign(key, expiresAt))
+	if err != nil {
+		return err
+	}
+	actual, err := hex.DecodeString(signature)
+	if err != nil || !hmac.Equal(expected, actual) {
+		return errInvalidSignature
+	}
+
+	expiresUnix, err := strconv.ParseInt(expiresAt, 10, 64)
+	if err != nil || time.Now().Unix() > expiresUnix {
+		return errExpiredLink
+	}
+	return nil
+}
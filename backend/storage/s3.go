@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// S3Config locates the bucket of an S3 compatible store. Endpoint is empty
+// for AWS, and set along with UsePathStyle for stores such as MinIO.
+// PublicEndpoint, when set, is the endpoint of the presigned URLs, for
+// stores the clients reach at another address than the backend.
+type S3Config struct {
+	Endpoint        string
+	PublicEndpoint  string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	UsePathStyle    bool
+}
+
+// S3 stores objects in a bucket of an S3 compatible store.
+type S3 struct {
+	client  *s3.Client
+	presign *s3.PresignClient
+	bucket  string
+}
+
+// NewS3 returns the storage of the configured bucket, checking that it can
+// be reached.
+func NewS3(ctx context.Context, config S3Config) (*S3, error) {
+	if config.Bucket == "" || config.AccessKeyID == "" || config.SecretAccessKey == "" {
+		return nil, fmt.Errorf("bucket and credentials are required")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+
+	credentials := aws.Credentials{
+		AccessKeyID:     config.AccessKeyID,
+		SecretAccessKey: config.SecretAccessKey,
+	}
+	options := s3.Options{
+		Region:       config.Region,
+		UsePathStyle: config.UsePathStyle,
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return credentials, nil
+		}),
+	}
+	if config.Endpoint != "" {
+		options.BaseEndpoint = aws.String(config.Endpoint)
+	}
+
+	client := s3.New(options)
+	storage := &S3{
+		client:  client,
+		presign: s3.NewPresignClient(client),
+		bucket:  config.Bucket,
+	}
+	if config.PublicEndpoint != "" {
+		storage.presign = s3.NewPresignClient(client, func(o *s3.PresignOptions) {
+			o.ClientOptions = append(o.ClientOptions, func(o *s3.Options) {
+				o.BaseEndpoint = aws.String(config.PublicEndpoint)
+			})
+		})
+	}
+
+	_, err := client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(config.Bucket)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach bucket %s: %w", config.Bucket, err)
+	}
+
+	return storage, nil
+}
+
+// notFound translates the 404 errors of the S3 API into ErrNotFound.
+func notFound(err error) error {
+	var responseErr *awshttp.ResponseError
+	if errors.As(err, &responseErr) && responseErr.HTTPStatusCode() == http.StatusNotFound {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Body:   r,
+	}
+	if contentType != "" {
+		input.ContentType = aws.String(contentType)
+	}
+
+	_, err = s.client.PutObject(ctx, input)
+	return err
+}
+
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, Object, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return nil, Object{}, err
+	}
+
+	output, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, Object{}, notFound(err)
+	}
+
+	return output.Body, Object{
+		Key:         key,
+		Size:        aws.ToInt64(output.ContentLength),
+		ModTime:     aws.ToTime(output.LastModified),
+		ContentType: aws.ToString(output.ContentType),
+	}, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+func (s *S3) Stat(ctx context.Context, key string) (Object, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return Object{}, err
+	}
+
+	output, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return Object{}, notFound(err)
+	}
+
+	return Object{
+		Key:         key,
+		Size:        aws.ToInt64(output.ContentLength),
+		ModTime:     aws.ToTime(output.LastModified),
+		ContentType: aws.ToString(output.ContentType),
+	}, nil
+}
+
+func (s *S3) PresignGet(ctx context.Context, key string, expires time.Duration) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	request, err := s.presign.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket:                     aws.String(s.bucket),
+		Key:                        aws.String(key),
+		ResponseContentDisposition: aws.String("attachment; filename=" + path.Base(key)),
+	}, s3.WithPresignExpires(expires))
+	if err != nil {
+		return "", err
+	}
+	return request.URL, nil
+}
@@ -0,0 +1,132 @@
+// Package storage keeps the inputs and results of the video operations,
+// on the local filesystem or in an S3 compatible object store.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+	"veedeo/config"
+)
+
+var (
+	ErrNotFound    = errors.New("object not found")
+	ErrInvalidKey  = errors.New("invalid object key")
+	ErrUnsupported = errors.New("not supported by this storage")
+)
+
+// Object describes a stored object.
+type Object struct {
+	Key         string
+	Size        int64
+	ModTime     time.Time
+	ContentType string
+}
+
+// Storage stores objects under slash separated keys such as
+// "results/<job id>/final.mp4".
+type Storage interface {
+	// Put stores the content read from r under key, replacing any previous
+	// object. S3 compatible stores need r to be an io.ReadSeeker, such as an
+	// *os.File, to sign the request.
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+	// Get opens the object stored under key. The reader is an
+	// io.ReadSeeker when the store allows it.
+	Get(ctx context.Context, key string) (io.ReadCloser, Object, error)
+	// Delete removes the object stored under key, if any.
+	Delete(ctx context.Context, key string) error
+	Stat(ctx context.Context, key string) (Object, error)
+	// PresignGet returns a URL downloading the object without further
+	// authentication until it expires. The download supports ranges. Local
+	// URLs are relative to the backend, see DownloadHandler.
+	PresignGet(ctx context.Context, key string, expires time.Duration) (string, error)
+}
+
+// New returns the storage of the storage section of cfg, "local" or "s3"
+// set up from the s3 section, checking that it can be used.
+func New(ctx context.Context, cfg *config.Config) (Storage, error) {
+	switch cfg.Storage.Backend {
+	case "local":
+		return NewLocal(cfg.Storage.Dir, []byte(cfg.Storage.SigningKey))
+	case "s3":
+		return NewS3(ctx, S3Config{
+			Endpoint:        cfg.S3.Endpoint,
+			PublicEndpoint:  cfg.S3.PublicEndpoint,
+			Region:          cfg.S3.Region,
+			Bucket:          cfg.S3.Bucket,
+			AccessKeyID:     cfg.S3.AccessKeyID,
+			SecretAccessKey: cfg.S3.SecretAccessKey,
+			UsePathStyle:    cfg.S3.UsePathStyle,
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Storage.Backend)
+	}
+}
+
+var defaultStorage Storage
+
+// Default returns the storage set with SetDefault.
+func Default() Storage {
+	return defaultStorage
+}
+
+// SetDefault makes s the storage returned by Default. It is called once at
+// startup, before the server starts.
+func SetDefault(s Storage) {
+	defaultStorage = s
+}
+
+// cleanKey validates key, rejecting absolute keys and keys going up the
+// hierarchy.
+func cleanKey(key string) (string, error) {
+	cleaned := path.Clean(key)
+	if key == "" || strings.HasPrefix(key, "/") || cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("%w %q", ErrInvalidKey, key)
+	}
+	return cleaned, nil
+}
+
+// Download copies the object stored under key to the file at dst, hard
+// linking it when the storage is local.
+func Download(ctx context.Context, s Storage, key, dst string) error {
+	if local, ok := s.(*Local); ok {
+		src, err := local.path(key)
+		if err != nil {
+			return err
+		}
+		if err := os.Link(src, dst); err == nil {
+			return nil
+		}
+	}
+
+	reader, _, err := s.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	file, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(file, reader)
+	return err
+}
+
+// Upload stores the file at src under key.
+func Upload(ctx context.Context, s Storage, src, key, contentType string) error {
+	file, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return s.Put(ctx, key, file, contentType)
+}
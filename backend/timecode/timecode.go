@@ -0,0 +1,236 @@
+// Package timecode parses the timestamps clients send to point into a video.
+package timecode
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Tolerance is how far past the duration of a video an end timestamp may
+// be, as players and ffprobe don't always agree on the exact duration.
+const Tolerance = 0.05
+
+// ErrInvalid is returned, wrapped, for malformed timecodes.
+var ErrInvalid = errors.New("invalid timecode")
+
+// Timecode is a position in a video, given as one of:
+//   - seconds: "12.5"
+//   - clock time: "MM:SS.mmm" or "HH:MM:SS.mmm"
+//   - SMPTE non-drop-frame timecode: "HH:MM:SS:FF", each timecode second
+//     counting the frame rate rounded up frames, e.g. 30 at 29.97 fps
+//   - a frame number: "300f"
+//
+// Frames are only turned into seconds once the frame rate is known, see
+// Seconds. The zero Timecode is unset, as when missing from JSON, which is
+// not the same as "0".
+type Timecode struct {
+	seconds float64
+	frames  int64
+	smpte   bool
+	isFrame bool
+	set     bool
+}
+
+// Parse parses s into a timecode. Negative values, exponents and anything
+// else than digits, one decimal point and colons are rejected.
+func Parse(s string) (Timecode, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Timecode{}, fmt.Errorf("%w: empty", ErrInvalid)
+	}
+
+	if digits, ok := strings.CutSuffix(s, "f"); ok {
+		frames, err := parseUint(digits)
+		if err != nil {
+			return Timecode{}, fmt.Errorf("%w %q", ErrInvalid, s)
+		}
+		return Timecode{frames: frames, isFrame: true, set: true}, nil
+	}
+
+	parts := strings.Split(s, ":")
+	switch len(parts) {
+	case 1, 2, 3:
+		seconds, err := parseClock(parts)
+		if err != nil {
+			return Timecode{}, fmt.Errorf("%w %q", ErrInvalid, s)
+		}
+		return Timecode{seconds: seconds, set: true}, nil
+
+	case 4:
+		seconds, err := parseClock(parts[:3])
+		if err != nil || strings.Contains(parts[2], ".") {
+			return Timecode{}, fmt.Errorf("%w %q", ErrInvalid, s)
+		}
+		frames, err := parseUint(parts[3])
+		if err != nil {
+			return Timecode{}, fmt.Errorf("%w %q", ErrInvalid, s)
+		}
+		return Timecode{seconds: seconds, frames: frames, smpte: true, set: true}, nil
+	}
+
+	return Timecode{}, fmt.Errorf("%w %q", ErrInvalid, s)
+}
+
+// FromSeconds returns the timecode of a position in seconds.
+func FromSeconds(seconds float64) (Timecode, error) {
+	if math.IsNaN(seconds) || math.IsInf(seconds, 0) || seconds < 0 {
+		return Timecode{}, fmt.Errorf("%w: %v seconds", ErrInvalid, seconds)
+	}
+	return Timecode{seconds: seconds, set: true}, nil
+}
+
+// IsZero reports whether t is unset.
+func (t Timecode) IsZero() bool {
+	return !t.set
+}
+
+// parseClock parses seconds optionally preceded by minutes and hours. Only
+// the seconds may have a fractional part and only the first part may go
+// past 59.
+func parseClock(parts []string) (float64, error) {
+	seconds := 0.0
+	for i, part := range parts {
+		last := i == len(parts)-1
+
+		var value float64
+		if last {
+			v, err := parseDecimal(part)
+			if err != nil {
+				return 0, err
+			}
+			value = v
+		} else {
+			v, err := parseUint(part)
+			if err != nil {
+				return 0, err
+			}
+			value = float64(v)
+		}
+
+		if i > 0 && value >= 60 {
+			return 0, fmt.Errorf("%q out of range", part)
+		}
+		seconds = seconds*60 + value
+	}
+	return seconds, nil
+}
+
+func parseUint(s string) (int64, error) {
+	if s == "" || strings.Trim(s, "0123456789") != "" {
+		return 0, fmt.Errorf("%q is not a number", s)
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+func parseDecimal(s string) (float64, error) {
+	whole, fraction, _ := strings.Cut(s, ".")
+	if whole == "" && fraction == "" || strings.Trim(whole, "0123456789") != "" || strings.Trim(fraction, "0123456789") != "" {
+		return 0, fmt.Errorf("%q is not a number", s)
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// Seconds returns the position in seconds in a video of the given frame
+// rate, which may be 0 if unknown unless the timecode counts frames.
+func (t Timecode) Seconds(fps float64) (float64, error) {
+	if !t.isFrame && !t.smpte {
+		return t.seconds, nil
+	}
+
+	if fps <= 0 {
+		return 0, fmt.Errorf("%w: %s needs a known frame rate", ErrInvalid, t)
+	}
+	if t.smpte && float64(t.frames) >= math.Ceil(fps) {
+		return 0, fmt.Errorf("%w: %s has more frames than the %g fps video", ErrInvalid, t, fps)
+	}
+	// a non-drop-frame timecode counts frames, which at fractional rates
+	// last longer than its seconds suggest
+	frames := t.seconds*math.Ceil(fps) + float64(t.frames)
+	return frames / fps, nil
+}
+
+// String returns the timecode in its normalized form, "HH:MM:SS.mmm",
+// "HH:MM:SS:FF" or "Nf".
+func (t Timecode) String() string {
+	switch {
+	case t.isFrame:
+		return fmt.Sprintf("%df", t.frames)
+	case t.smpte:
+		whole := int64(t.seconds)
+		return fmt.Sprintf("%02d:%02d:%02d:%02d", whole/3600, whole/60%60, whole%60, t.frames)
+	}
+	return Format(t.seconds)
+}
+
+// Format formats seconds as "HH:MM:SS.mmm".
+func Format(seconds float64) string {
+	millis := int64(math.Round(seconds * 1000))
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", millis/3600000, millis/60000%60, millis/1000%60, millis%1000)
+}
+
+// UnmarshalJSON accepts a timecode string or a number of seconds.
+func (t *Timecode) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		parsed, err := Parse(s)
+		if err != nil {
+			return err
+		}
+		*t = parsed
+		return nil
+	}
+
+	var seconds float64
+	if err := json.Unmarshal(data, &seconds); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalid, data)
+	}
+	parsed, err := FromSeconds(seconds)
+	if err != nil {
+		return err
+	}
+	*t = parsed
+	return nil
+}
+
+// MarshalJSON encodes the normalized timecode.
+func (t Timecode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.String())
+}
+
+// Range resolves start and end in a video of the given frame rate and
+// duration and checks that start < duration and start < end <= duration.
+// Both are required, an unset start is not taken as 0. The returned end is
+// clamped to duration.
+func Range(start, end Timecode, fps, duration float64) (float64, float64, error) {
+	if start.IsZero() {
+		return 0, 0, fmt.Errorf("start is required")
+	}
+	if end.IsZero() {
+		return 0, 0, fmt.Errorf("end is required")
+	}
+
+	startSeconds, err := start.Seconds(fps)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid start: %w", err)
+	}
+	endSeconds, err := end.Seconds(fps)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid end: %w", err)
+	}
+
+	switch {
+	case endSeconds <= startSeconds:
+		return 0, 0, fmt.Errorf("end must be after start")
+	case startSeconds >= duration:
+		// the end would be clamped to duration, leaving nothing
+		return 0, 0, fmt.Errorf("start %s is past the end of the %s video", start, Format(duration))
+	case endSeconds > duration+Tolerance:
+		return 0, 0, fmt.Errorf("end %s is past the end of the %s video", end, Format(duration))
+	}
+
+	return startSeconds, math.Min(endSeconds, duration), nil
+}
@@ -0,0 +1,242 @@
+package timecode
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+// approxEqual reports whether got and want are equal within a microsecond.
+func approxEqual(got, want float64) bool {
+	return math.Abs(got-want) < 1e-6
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input  string
+		fps    float64
+		want   float64
+		string string
+	}{
+		{"0", 0, 0, "00:00:00.000"},
+		{"12.5", 0, 12.5, "00:00:12.500"},
+		{" 7 ", 0, 7, "00:00:07.000"},
+		{"90", 0, 90, "00:01:30.000"},
+		{"01:30", 0, 90, "00:01:30.000"},
+		{"75:00", 0, 4500, "01:15:00.000"},
+		{"01:02:03.456", 0, 3723.456, "01:02:03.456"},
+		{"00:00:10:15", 30, 10.5, "00:00:10:15"},
+		{"01:00:00:00", 25, 3600, "01:00:00:00"},
+		{"300f", 30, 10, "300f"},
+		{"0f", 30, 0, "0f"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			tc, err := Parse(test.input)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", test.input, err)
+			}
+			if tc.IsZero() {
+				t.Errorf("Parse(%q) is unset", test.input)
+			}
+			seconds, err := tc.Seconds(test.fps)
+			if err != nil {
+				t.Fatalf("Seconds(%g) error = %v", test.fps, err)
+			}
+			if !approxEqual(seconds, test.want) {
+				t.Errorf("Seconds(%g) = %g, want %g", test.fps, seconds, test.want)
+			}
+			if got := tc.String(); got != test.string {
+				t.Errorf("String() = %q, want %q", got, test.string)
+			}
+		})
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	for _, input := range []string{
+		"",
+		"-1",
+		"1e3",
+		"+1",
+		".",
+		"1.2.3",
+		"0x10",
+		"1:60",
+		"1:60:00",
+		"1:1.5:00",
+		"00:00:01.5:03",
+		"00:00:01:-1",
+		"1:2:3:4:5",
+		"f",
+		"1.5f",
+		"-3f",
+		"NaN",
+		"Inf",
+	} {
+		t.Run(input, func(t *testing.T) {
+			if tc, err := Parse(input); !errors.Is(err, ErrInvalid) {
+				t.Errorf("Parse(%q) = %v, %v, want %v", input, tc, err, ErrInvalid)
+			}
+		})
+	}
+}
+
+func TestSecondsSMPTE(t *testing.T) {
+	const ntsc = 30000.0 / 1001
+
+	tests := []struct {
+		input string
+		want  float64
+	}{
+		// each timecode second counts 30 frames, lasting 1.001 seconds
+		{"00:00:01:00", 1.001},
+		{"00:00:00:29", 29 / ntsc},
+		{"00:01:00:00", 60.06},
+		{"01:00:00:00", 3603.6},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			seconds, err := mustParse(t, test.input).Seconds(ntsc)
+			if err != nil {
+				t.Fatalf("Seconds() error = %v", err)
+			}
+			if !approxEqual(seconds, test.want) {
+				t.Errorf("Seconds() = %g, want %g", seconds, test.want)
+			}
+		})
+	}
+
+	t.Run("frames past the rounded up rate", func(t *testing.T) {
+		if _, err := mustParse(t, "00:00:00:30").Seconds(ntsc); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Seconds() error = %v, want %v", err, ErrInvalid)
+		}
+	})
+
+	t.Run("unknown frame rate", func(t *testing.T) {
+		for _, input := range []string{"00:00:01:00", "30f"} {
+			if _, err := mustParse(t, input).Seconds(0); !errors.Is(err, ErrInvalid) {
+				t.Errorf("%s: Seconds(0) error = %v, want %v", input, err, ErrInvalid)
+			}
+		}
+	})
+}
+
+func TestRange(t *testing.T) {
+	tests := []struct {
+		name      string
+		start     string
+		end       string
+		wantStart float64
+		wantEnd   float64
+		wantErr   bool
+	}{
+		{name: "within", start: "1", end: "5", wantStart: 1, wantEnd: 5},
+		{name: "whole video", start: "0", end: "10", wantStart: 0, wantEnd: 10},
+		{name: "frames", start: "30f", end: "00:00:02:00", wantStart: 1, wantEnd: 2},
+		{name: "end within tolerance is clamped", start: "9", end: "10.04", wantStart: 9, wantEnd: 10},
+		{name: "end past tolerance", start: "9", end: "10.1", wantErr: true},
+		{name: "start at duration", start: "10", end: "10.01", wantErr: true},
+		{name: "start past duration", start: "11", end: "12", wantErr: true},
+		{name: "end before start", start: "5", end: "4", wantErr: true},
+		{name: "empty range", start: "5", end: "5", wantErr: true},
+		{name: "too many frames", start: "0", end: "00:00:01:30", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			start, end, err := Range(mustParse(t, test.start), mustParse(t, test.end), 30, 10)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("Range() = %g, %g, want an error", start, end)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Range() error = %v", err)
+			}
+			if !approxEqual(start, test.wantStart) || !approxEqual(end, test.wantEnd) {
+				t.Errorf("Range() = %g, %g, want %g, %g", start, end, test.wantStart, test.wantEnd)
+			}
+		})
+	}
+
+	t.Run("unset", func(t *testing.T) {
+		if _, _, err := Range(Timecode{}, mustParse(t, "5"), 30, 10); err == nil {
+			t.Error("Range() with an unset start succeeded")
+		}
+		if _, _, err := Range(mustParse(t, "0"), Timecode{}, 30, 10); err == nil {
+			t.Error("Range() with an unset end succeeded")
+		}
+	})
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    float64
+		wantErr bool
+	}{
+		{input: `"01:30"`, want: 90},
+		{input: `"12.5"`, want: 12.5},
+		{input: `"60f"`, want: 2},
+		{input: `12.5`, want: 12.5},
+		{input: `0`, want: 0},
+		{input: `-1`, wantErr: true},
+		{input: `"-1"`, wantErr: true},
+		{input: `"1:60"`, wantErr: true},
+		{input: `true`, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			var v struct {
+				At Timecode `json:"at"`
+			}
+			err := json.Unmarshal([]byte(`{"at":`+test.input+`}`), &v)
+			if test.wantErr {
+				if !errors.Is(err, ErrInvalid) {
+					t.Errorf("Unmarshal() error = %v, want %v", err, ErrInvalid)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+
+			seconds, err := v.At.Seconds(30)
+			if err != nil {
+				t.Fatalf("Seconds() error = %v", err)
+			}
+			if !approxEqual(seconds, test.want) {
+				t.Errorf("Seconds() = %g, want %g", seconds, test.want)
+			}
+		})
+	}
+
+	t.Run("missing", func(t *testing.T) {
+		var v struct {
+			At Timecode `json:"at"`
+		}
+		if err := json.Unmarshal([]byte(`{}`), &v); err != nil {
+			t.Fatal(err)
+		}
+		if !v.At.IsZero() {
+			t.Errorf("missing timecode is set: %v", v.At)
+		}
+	})
+}
+
+// mustParse parses s, failing the test if it is invalid.
+func mustParse(t *testing.T, s string) Timecode {
+	t.Helper()
+
+	tc, err := Parse(s)
+	if err != nil {
+		t.Fatalf("Parse(%q) error = %v", s, err)
+	}
+	return tc
+}
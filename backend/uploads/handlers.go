@@ -0,0 +1,185 @@
+package uploads
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The subset of the tus protocol (https://tus.io/protocols/resumable-upload)
+// implemented by these handlers.
+const (
+	TusVersion    = "1.0.0"
+	TusExtensions = "creation,termination,expiration"
+)
+
+// checkTusVersion replies 412 unless the client speaks our tus version.
+func checkTusVersion(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Set("Tus-Resumable", TusVersion)
+	if r.Header.Get("Tus-Resumable") != TusVersion {
+		w.Header().Set("Tus-Version", TusVersion)
+		http.Error(w, "Unsupported tus version.", http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+// uploadRetryAfter is how long clients are told to wait when the store is
+// full.
+const uploadRetryAfter = time.Minute
+
+func setExpires(w http.ResponseWriter, upload *Upload) {
+	w.Header().Set("Upload-Expires", upload.ExpiresAt(UploadStore.TTL()).UTC().Format(http.TimeFormat))
+}
+
+// UploadOptionsHandler describes the server capabilities.
+func UploadOptionsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", TusVersion)
+	w.Header().Set("Tus-Version", TusVersion)
+	w.Header().Set("Tus-Extension", TusExtensions)
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(UploadStore.MaxSize(), 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UploadCreateHandler starts an upload of Upload-Length bytes and replies
+// with its URL in Location.
+func UploadCreateHandler(w http.ResponseWriter, r *http.Request) {
+	if !checkTusVersion(w, r) {
+		return
+	}
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		http.Error(w, "Invalid Upload-Length.", http.StatusBadRequest)
+		return
+	}
+
+	metadata, err := parseMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		http.Error(w, "Invalid Upload-Metadata.", http.StatusBadRequest)
+		return
+	}
+
+	upload, err := UploadStore.Create(length, metadata)
+	if errors.Is(err, ErrTooLarge) {
+		http.Error(w, "Upload too large.", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if errors.Is(err, ErrStoreFull) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(uploadRetryAfter.Seconds())))
+		http.Error(w, "Too many uploads in progress, try again later.", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		log.Println("Error creating upload:", err)
+		http.Error(w, "Failed to create upload", http.StatusInternalServerError)
+		return
+	}
+
+	setExpires(w, upload)
+	w.Header().Set("Location", "/uploads/"+upload.ID)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// parseMetadata decodes the Upload-Metadata header, a comma separated list
+// of keys each followed by its base64 encoded value.
+func parseMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, fmt.Errorf("empty metadata key")
+		}
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("metadata %q: %w", key, err)
+		}
+		metadata[key] = string(value)
+	}
+
+	return metadata, nil
+}
+
+// UploadHeadHandler returns the offset to resume upload {id} from.
+func UploadHeadHandler(w http.ResponseWriter, r *http.Request) {
+	if !checkTusVersion(w, r) {
+		return
+	}
+
+	upload, ok := UploadStore.Get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Upload not found", http.StatusNotFound)
+		return
+	}
+
+	setExpires(w, upload)
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset(), 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	w.WriteHeader(http.StatusOK)
+}
+
+// UploadPatchHandler appends the request body to upload {id}, starting at
+// Upload-Offset.
+func UploadPatchHandler(w http.ResponseWriter, r *http.Request) {
+	if !checkTusVersion(w, r) {
+		return
+	}
+
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		http.Error(w, "Content-Type must be application/offset+octet-stream.", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "Invalid Upload-Offset.", http.StatusBadRequest)
+		return
+	}
+
+	upload, ok := UploadStore.Get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Upload not found", http.StatusNotFound)
+		return
+	}
+
+	newOffset, err := upload.Write(offset, r.Body)
+	w.Header().Set("Upload-Offset", strconv.FormatInt(newOffset, 10))
+	setExpires(w, upload)
+
+	switch {
+	case errors.Is(err, ErrOffsetMismatch):
+		http.Error(w, "Upload-Offset does not match the upload.", http.StatusConflict)
+	case errors.Is(err, ErrTooLarge):
+		http.Error(w, "Chunk goes past Upload-Length.", http.StatusRequestEntityTooLarge)
+	case err != nil:
+		// the bytes received so far are kept, the client resumes from HEAD
+		log.Printf("Error writing upload %s: %v", upload.ID, err)
+		http.Error(w, "Failed to write chunk", http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// UploadDeleteHandler aborts upload {id} and removes its data.
+func UploadDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	if !checkTusVersion(w, r) {
+		return
+	}
+
+	if !UploadStore.Delete(r.PathValue("id")) {
+		http.Error(w, "Upload not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
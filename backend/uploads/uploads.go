@@ -0,0 +1,288 @@
+package uploads
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrNotFound       = errors.New("upload not found")
+	ErrIncomplete     = errors.New("upload is not complete")
+	ErrOffsetMismatch = errors.New("upload offset mismatch")
+	ErrTooLarge       = errors.New("upload too large")
+	ErrStoreFull      = errors.New("too many uploads in progress")
+)
+
+// Upload is a file sent in chunks, resumable from Offset after a failure.
+type Upload struct {
+	ID       string
+	Length   int64
+	Metadata map[string]string
+
+	path string
+
+	// writeMutex serializes the chunks, mutex guards the fields below
+	writeMutex sync.Mutex
+	mutex      sync.Mutex
+	offset     int64
+	updatedAt  time.Time
+}
+
+// Offset returns how many bytes have been received.
+func (u *Upload) Offset() int64 {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	return u.offset
+}
+
+// Complete reports whether all Length bytes have been received.
+func (u *Upload) Complete() bool {
+	return u.Offset() == u.Length
+}
+
+// ExpiresAt returns when the upload will be removed unless it is used.
+func (u *Upload) ExpiresAt(ttl time.Duration) time.Time {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	return u.updatedAt.Add(ttl)
+}
+
+func (u *Upload) touch() {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	u.updatedAt = time.Now()
+}
+
+// Write appends the chunk read from r, which must start at offset. Bytes
+// received before a read error are kept, so the client can resume from the
+// returned offset.
+func (u *Upload) Write(offset int64, r io.Reader) (int64, error) {
+	u.writeMutex.Lock()
+	defer u.writeMutex.Unlock()
+
+	current := u.Offset()
+	if offset != current {
+		return current, ErrOffsetMismatch
+	}
+
+	file, err := os.OpenFile(u.path, os.O_WRONLY, 0)
+	if err != nil {
+		return current, err
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return current, err
+	}
+
+	// read one byte past the end to detect oversized chunks
+	remaining := u.Length - offset
+	n, err := io.Copy(file, io.LimitReader(r, remaining+1))
+	if n > remaining {
+		n = remaining
+		file.Truncate(u.Length)
+		err = ErrTooLarge
+	}
+
+	u.mutex.Lock()
+	u.offset += n
+	u.updatedAt = time.Now()
+	current = u.offset
+	u.mutex.Unlock()
+
+	return current, err
+}
+
+// Store keeps uploads on disk under dir and removes the ones not touched
+// for ttl. It holds at most maxUploads uploads of maxTotal bytes in all,
+// counting the announced length of the unfinished ones.
+type Store struct {
+	dir        string
+	maxSize    int64
+	maxTotal   int64
+	maxUploads int
+	ttl        time.Duration
+	uploads    map[string]*Upload
+	mutex      sync.Mutex
+}
+
+var UploadStore = NewStore(filepath.Join(os.TempDir(), "veedeo-uploads"), 500*1024*1024, 10*1024*1024*1024, 100, 24*time.Hour)
+
+func NewStore(dir string, maxSize, maxTotal int64, maxUploads int, ttl time.Duration) *Store {
+	s := &Store{
+		dir:        dir,
+		maxSize:    maxSize,
+		maxTotal:   maxTotal,
+		maxUploads: maxUploads,
+		ttl:        ttl,
+		uploads:    make(map[string]*Upload),
+	}
+	go s.cleanup()
+
+	return s
+}
+
+// Create starts an upload of length bytes. It fails with ErrStoreFull when
+// the store can't take it until other uploads expire or are deleted.
+func (s *Store) Create(length int64, metadata map[string]string) (*Upload, error) {
+	if length > s.maxSize {
+		return nil, fmt.Errorf("%w: %d bytes, at most %d", ErrTooLarge, length, s.maxSize)
+	}
+
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return nil, err
+	}
+
+	upload := &Upload{
+		ID:        uuid.New().String(),
+		Length:    length,
+		Metadata:  metadata,
+		updatedAt: time.Now(),
+	}
+	upload.path = filepath.Join(s.dir, upload.ID)
+
+	// the upload is added right away so that concurrent creations count it
+	if err := s.add(upload); err != nil {
+		return nil, err
+	}
+
+	file, err := os.Create(upload.path)
+	if err != nil {
+		s.Delete(upload.ID)
+		return nil, err
+	}
+	file.Close()
+
+	return upload, nil
+}
+
+// add adds upload to the store unless it would go past its limits.
+func (s *Store) add(upload *Upload) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	total := upload.Length
+	for _, other := range s.uploads {
+		total += other.Length
+	}
+	if len(s.uploads) >= s.maxUploads || total > s.maxTotal {
+		return fmt.Errorf("%w: %d uploads of %d bytes", ErrStoreFull, len(s.uploads), total-upload.Length)
+	}
+
+	s.uploads[upload.ID] = upload
+	return nil
+}
+
+func (s *Store) Get(id string) (*Upload, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	upload, ok := s.uploads[id]
+	return upload, ok
+}
+
+// Delete removes upload id and its data.
+func (s *Store) Delete(id string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	upload, ok := s.uploads[id]
+	if !ok {
+		return false
+	}
+	s.remove(upload)
+	return true
+}
+
+// Clear removes every upload, whose data would otherwise be left behind by
+// a restart.
+func (s *Store) Clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, upload := range s.uploads {
+		s.remove(upload)
+	}
+}
+
+// CopyTo makes the completed upload id available at path, hard linked when
+// possible, so that it can be used by several requests. Using an upload
+// postpones its expiry.
+func (s *Store) CopyTo(id, path string) error {
+	upload, ok := s.Get(id)
+	if !ok {
+		return ErrNotFound
+	}
+	if !upload.Complete() {
+		return ErrIncomplete
+	}
+	upload.touch()
+
+	return LinkOrCopy(upload.path, path)
+}
+
+// LinkOrCopy makes the file at src available at dst, hard linked when both
+// are on the same filesystem and copied otherwise.
+func LinkOrCopy(src, dst string) error {
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	dstFile, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer dstFile.Close()
+
+	_, err = io.Copy(dstFile, srcFile)
+	return err
+}
+
+// MaxSize returns the largest upload accepted.
+func (s *Store) MaxSize() int64 {
+	return s.maxSize
+}
+
+// TTL returns how long uploads are kept once left untouched.
+func (s *Store) TTL() time.Duration {
+	return s.ttl
+}
+
+func (s *Store) remove(upload *Upload) {
+	if err := os.Remove(upload.path); err != nil && !os.IsNotExist(err) {
+		log.Printf("Error removing upload %s: %v", upload.ID, err)
+	}
+	delete(s.uploads, upload.ID)
+}
+
+func (s *Store) cleanup() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.mutex.Lock()
+		for _, upload := range s.uploads {
+			if time.Now().After(upload.ExpiresAt(s.ttl)) {
+				s.remove(upload)
+			}
+		}
+		s.mutex.Unlock()
+	}
+}
@@ -0,0 +1,36 @@
+package video
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"veedeo/assets"
+)
+
+// VideoAssetHandler validates the uploaded video, sent as "videoFile" or
+// referenced by "uploadId", and keeps it as an asset that other operations
+// can use through "assetId".
+func VideoAssetHandler(w http.ResponseWriter, r *http.Request) {
+	if !parseVideoForm(w, r) {
+		return
+	}
+
+	tempDir, inputFile, info, ok := receiveVideoUpload(w, r)
+	if !ok {
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	asset, err := assets.AssetStore.Add(r.Context(), inputFile, info)
+	if err != nil {
+		fmt.Println("Error storing asset:", err)
+		http.Error(w, "Failed to store video", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/assets/"+asset.ID)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(asset.Describe(assets.AssetStore.TTL()))
+}
@@ -0,0 +1,82 @@
+package video
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"veedeo/cobalt"
+	"veedeo/events"
+	"veedeo/fetch"
+	"veedeo/jobs"
+)
+
+// cobaltQuality converts a VideoRequest format to a cobalt videoQuality.
+func cobaltQuality(format string) (string, error) {
+	switch format {
+	case "", "best":
+		return "max", nil
+	case "1080p", "720p", "480p", "360p":
+		return strings.TrimSuffix(format, "p"), nil
+	default:
+		return "", fmt.Errorf("unknown format %q, use best, 1080p, 720p, 480p or 360p", format)
+	}
+}
+
+// VideoCobaltImportHandler resolves the requested social media URL through
+// the cobalt instance and downloads the video in a background job, which
+// stores it as an asset and reports its ID in the assetId output.
+func VideoCobaltImportHandler(w http.ResponseWriter, r *http.Request) {
+	client := cobalt.Default()
+	if client == nil {
+		http.Error(w, "Cobalt import is not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+	var videoReq VideoRequest
+	if err := json.NewDecoder(r.Body).Decode(&videoReq); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	limits := defaultImportLimits()
+	if err := limits.checkURL(videoReq.URL); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid video URL: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	quality, err := cobaltQuality(videoReq.Format)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid format: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	tempDir, err := os.MkdirTemp("", "videoimport")
+	if err != nil {
+		http.Error(w, "Failed to create temporary directory", http.StatusInternalServerError)
+		return
+	}
+
+	submitted := submitVideoJob(w, tempDir, func(ctx context.Context, job *jobs.Job) (string, error) {
+		events.SseManager.UpdateProgress(job.ID, events.Progress{Stage: "resolving"})
+		media, err := client.Resolve(ctx, cobalt.Request{URL: videoReq.URL, VideoQuality: quality})
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve video: %w", err)
+		}
+
+		// tunnel URLs point to the instance itself, which may be on our network
+		path := filepath.Join(job.Dir, "download")
+		if err := fetchVideo(ctx, fetch.Default().Trust(client.BaseURL), job.ID, media.URL, path); err != nil {
+			return "", err
+		}
+		return "", storeImportedVideo(ctx, job, path)
+	})
+	if !submitted {
+		os.RemoveAll(tempDir)
+	}
+}
@@ -1,122 +1,282 @@
 package video
 
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"veedeo/assets"
+	"veedeo/config"
+	"veedeo/events"
+	"veedeo/ffmpeg"
+	"veedeo/jobs"
+	"veedeo/media"
+)
+
 type VideoRequest struct {
 	URL string `json:"url"`
+	// Format is the quality to download, "best" (default) or a maximum
+	// height such as "720p".
+	Format string `json:"format,omitempty"`
 }
 
-/*
-func VideoStreamYTHandler(w http.ResponseWriter, r *http.Request) {
-	yt_client := youtube.Client{}
+// importLimits restrict what /video/import downloads.
+type importLimits struct {
+	domains     []string
+	maxDuration float64
+	maxSize     int64
+}
 
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
-		return
+// defaultImportLimits returns the limits of the import section of the
+// configuration.
+func defaultImportLimits() importLimits {
+	cfg := config.Current().Import
+
+	limits := importLimits{
+		maxDuration: cfg.MaxDuration,
+		maxSize:     cfg.MaxSizeMB * 1024 * 1024,
+	}
+	for _, domain := range cfg.AllowedDomains {
+		limits.domains = append(limits.domains, strings.ToLower(domain))
 	}
-	defer r.Body.Close()
 
-	var video_req VideoRequest
-	if err := json.Unmarshal(body, &video_req); err != nil {
-		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
-		return
+	return limits
+}
+
+// checkURL accepts http(s) URLs of the allowed domains and their
+// subdomains.
+func (l importLimits) checkURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("not an http(s) URL")
 	}
 
-	video, err := yt_client.GetVideo(video_req.URL)
-	if err != nil {
-		http.Error(w, "Failed to fetch video details", http.StatusInternalServerError)
-		return
+	host := strings.ToLower(u.Hostname())
+	for _, domain := range l.domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return nil
+		}
 	}
+	return fmt.Errorf("%s is not an allowed domain", host)
+}
 
-	fmt.Println(video.Title)
+// importFormat returns the yt-dlp format selector of the requested quality,
+// preferring streams that can be merged into an mp4 without re-encoding.
+func importFormat(format string) (string, error) {
+	filter := ""
+	switch format {
+	case "", "best":
+	case "1080p", "720p", "480p", "360p":
+		filter = fmt.Sprintf("[height<=%s]", strings.TrimSuffix(format, "p"))
+	default:
+		return "", fmt.Errorf("unknown format %q, use best, 1080p, 720p, 480p or 360p", format)
+	}
 
-	formats := video.Formats.WithAudioChannels()
+	return fmt.Sprintf("bv*%[1]s[ext=mp4]+ba[ext=m4a]/b%[1]s[ext=mp4]/bv*%[1]s+ba/b%[1]s", filter), nil
+}
 
-	fmt.Printf("%v", formats)
+// VideoImportHandler downloads the video at the requested URL with yt-dlp
+// in a background job, which stores it as an asset and reports its ID in
+// the assetId output.
+func VideoImportHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
 
-	stream, s_size, err := yt_client.GetStream(video, &formats[0])
-	if err != nil {
-		http.Error(w, "Failed to get video stream", http.StatusInternalServerError)
+	var videoReq VideoRequest
+	if err := json.NewDecoder(r.Body).Decode(&videoReq); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
 		return
 	}
-	defer stream.Close()
-
-	fmt.Println(s_size)
-
-	w.Header().Set("Content-Type", "video/mp4")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
 
-	if _, err := io.Copy(w, stream); err != nil {
-		http.Error(w, "Failed to stream video", http.StatusInternalServerError)
+	limits := defaultImportLimits()
+	if err := limits.checkURL(videoReq.URL); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid video URL: %v", err), http.StatusBadRequest)
 		return
 	}
-}
-*/
 
-/*
-func VideoStreamYTHandler(w http.ResponseWriter, r *http.Request) {
-	body, err := io.ReadAll(r.Body)
+	format, err := importFormat(videoReq.Format)
 	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		http.Error(w, fmt.Sprintf("Invalid format: %v", err), http.StatusBadRequest)
 		return
 	}
-	defer r.Body.Close()
 
-	var videoReq VideoRequest
-	if err := json.Unmarshal(body, &videoReq); err != nil {
-		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+	tempDir, err := os.MkdirTemp("", "videoimport")
+	if err != nil {
+		http.Error(w, "Failed to create temporary directory", http.StatusInternalServerError)
 		return
 	}
 
-	if videoReq.URL == "" {
-		http.Error(w, "Missing video URL", http.StatusBadRequest)
-		return
+	submitted := submitVideoJob(w, tempDir, func(ctx context.Context, job *jobs.Job) (string, error) {
+		path, err := downloadVideo(ctx, job.ID, job.Dir, videoReq.URL, format, limits)
+		if err != nil {
+			return "", err
+		}
+		return "", storeImportedVideo(ctx, job, path)
+	})
+	if !submitted {
+		os.RemoveAll(tempDir)
 	}
+}
 
-	cmd := exec.Command("yt-dlp", "-o", "-", "-f", "best", videoReq.URL)
+// storeImportedVideo validates the downloaded video at path and adds it to
+// the asset store.
+func storeImportedVideo(ctx context.Context, job *jobs.Job, path string) error {
+	info, err := media.DefaultAllowlist().Check(ctx, path)
+	if err != nil {
+		return fmt.Errorf("downloaded video rejected: %w", err)
+	}
 
-	stderrPipe, err := cmd.StderrPipe()
+	asset, err := assets.AssetStore.Add(ctx, path, info)
 	if err != nil {
-		log.Printf("StderrPipe error: %v", err)
-		http.Error(w, "Failed to initialize stderr stream", http.StatusInternalServerError)
-		return
+		return err
 	}
 
-	cmdOutput, err := cmd.StdoutPipe()
+	job.SetOutput("assetId", asset.ID)
+	return nil
+}
+
+// videoMetadata is the part of the yt-dlp JSON dump checked before
+// downloading.
+type videoMetadata struct {
+	Duration       float64 `json:"duration"`
+	Filesize       int64   `json:"filesize"`
+	FilesizeApprox int64   `json:"filesize_approx"`
+	IsLive         bool    `json:"is_live"`
+	WebpageURL     string  `json:"webpage_url"`
+}
+
+// ytDLP runs yt-dlp ignoring any user configuration, with the URL after
+// "--" so it can't be taken for an option.
+func ytDLP(ctx context.Context, rawURL string, args ...string) *exec.Cmd {
+	args = append([]string{"--no-config", "--no-playlist"}, args...)
+	cmd := exec.CommandContext(ctx, "yt-dlp", append(args, "--", rawURL)...)
+	ffmpeg.KillProcessGroupOnCancel(cmd)
+	return cmd
+}
+
+// checkVideoMetadata rejects live streams and videos over the limits before
+// anything is downloaded.
+func checkVideoMetadata(ctx context.Context, rawURL string, limits importLimits) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := ytDLP(ctx, rawURL, "--skip-download", "--dump-single-json")
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
 	if err != nil {
-		log.Printf("StdoutPipe error: %v", err)
-		http.Error(w, "Failed to initialize video stream", http.StatusInternalServerError)
-		return
+		fmt.Println("yt-dlp Output:", stderr.String())
+		return fmt.Errorf("failed to read video information: %w", err)
 	}
 
-	log.Println("Pipes initialized successfully.")
+	var metadata videoMetadata
+	if err := json.Unmarshal(output, &metadata); err != nil {
+		return fmt.Errorf("failed to read video information: %w", err)
+	}
 
-	if err := cmd.Start(); err != nil {
-		log.Printf("Command start error: %v", err)
-		http.Error(w, "Failed to start video stream", http.StatusInternalServerError)
-		return
+	size := max(metadata.Filesize, metadata.FilesizeApprox)
+	switch {
+	case metadata.IsLive:
+		return fmt.Errorf("live streams can't be imported")
+	case metadata.Duration > limits.maxDuration:
+		return fmt.Errorf("video is longer than %s", time.Duration(limits.maxDuration*float64(time.Second)))
+	case size > limits.maxSize:
+		return fmt.Errorf("video is larger than %d MB", limits.maxSize/1024/1024)
 	}
 
-	// Log stderr in a goroutine
-	go func() {
-		stderrData, _ := io.ReadAll(stderrPipe)
-		log.Printf("yt-dlp stderr: %s", string(stderrData))
-	}()
+	// redirects may have led somewhere else
+	if metadata.WebpageURL != "" {
+		if err := limits.checkURL(metadata.WebpageURL); err != nil {
+			return err
+		}
+	}
 
-	if _, err := io.Copy(w, cmdOutput); err != nil {
-		log.Printf("Streaming error: %v", err)
-		http.Error(w, "Failed to stream video", http.StatusInternalServerError)
-		return
+	return nil
+}
+
+// progressPrefix marks the yt-dlp progress lines, formatted by the
+// --progress-template given in downloadVideo.
+const progressPrefix = "veedeo-progress"
+
+// downloadVideo downloads the video at rawURL into workDir and returns its
+// path, publishing the progress to the SSE topic jobID.
+func downloadVideo(ctx context.Context, jobID, workDir, rawURL, format string, limits importLimits) (string, error) {
+	events.SseManager.UpdateProgress(jobID, events.Progress{Stage: "checking"})
+	if err := checkVideoMetadata(ctx, rawURL, limits); err != nil {
+		return "", err
+	}
+
+	cmd := ytDLP(ctx, rawURL,
+		"-f", format,
+		"--merge-output-format", "mp4",
+		"--max-filesize", strconv.FormatInt(limits.maxSize, 10),
+		"--match-filter", fmt.Sprintf("!is_live & duration <= %d", int(limits.maxDuration)),
+		"-o", filepath.Join(workDir, "download.%(ext)s"),
+		"--newline",
+		"--progress-template", "download:"+progressPrefix+" %(progress.downloaded_bytes)s %(progress.total_bytes)s %(progress.total_bytes_estimate)s %(progress.eta)s")
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", err
+	}
+	if err := cmd.Start(); err != nil {
+		return "", err
 	}
 
-	log.Println("Video stream completed successfully.")
+	events.SseManager.UpdateProgress(jobID, events.Progress{Stage: "downloading"})
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 5 || fields[0] != progressPrefix {
+			continue
+		}
+
+		// unknown values are printed as NA
+		downloaded, _ := strconv.ParseFloat(fields[1], 64)
+		total, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			total, _ = strconv.ParseFloat(fields[3], 64)
+		}
+		eta, _ := strconv.ParseFloat(fields[4], 64)
+
+		progress := events.Progress{Stage: "downloading", ETA: eta}
+		if total > 0 {
+			progress.Percent = min(100, downloaded/total*100)
+		}
+		events.SseManager.UpdateProgress(jobID, progress)
+	}
 
 	if err := cmd.Wait(); err != nil {
-		log.Printf("Command wait error: %v", err)
-		http.Error(w, "Error during video streaming", http.StatusInternalServerError)
-		return
+		fmt.Println("yt-dlp Output:", stderr.String())
+		return "", fmt.Errorf("failed to download video: %w", err)
+	}
+
+	// filters such as --max-filesize skip the video without failing
+	matches, _ := filepath.Glob(filepath.Join(workDir, "download.*"))
+	if len(matches) != 1 {
+		return "", fmt.Errorf("video was skipped, it is probably over the size or duration limits")
+	}
+
+	stat, err := os.Stat(matches[0])
+	if err != nil {
+		return "", err
+	}
+	if stat.Size() > limits.maxSize {
+		return "", fmt.Errorf("video is larger than %d MB", limits.maxSize/1024/1024)
 	}
 
-	log.Println("Command finished successfully.")
+	return matches[0], nil
 }
-*/
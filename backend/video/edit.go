@@ -0,0 +1,235 @@
+package video
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"veedeo/ffmpeg"
+	"veedeo/jobs"
+	"veedeo/media"
+	"veedeo/timecode"
+)
+
+// Edit operations, applied in order. Timestamps of each operation refer to
+// the video as produced by the previous ones.
+const (
+	EditTrim  = "trim"
+	EditSpeed = "speed"
+	EditCrop  = "crop"
+	EditScale = "scale"
+	EditMute  = "mute"
+)
+
+const (
+	maxEditOperations = 32
+	maxEditDimension  = 7680
+)
+
+// EditOperation is an entry of the edit list sent to /video/edit. Only the
+// fields of its Op are used:
+//   - trim: Ranges to keep
+//   - speed: Segments to retime
+//   - crop: Width, Height, X, Y of the area to keep, the size being even
+//   - scale: even Width, Height, one of them may be -2 to keep the aspect
+//     ratio
+//   - mute: Start, End of the silenced range, the whole video when empty
+type EditOperation struct {
+	Op       string             `json:"op"`
+	Ranges   []TrimRange        `json:"ranges,omitempty"`
+	Segments []SpeedSegment     `json:"segments,omitempty"`
+	Width    int                `json:"width,omitempty"`
+	Height   int                `json:"height,omitempty"`
+	X        int                `json:"x,omitempty"`
+	Y        int                `json:"y,omitempty"`
+	Start    *timecode.Timecode `json:"start,omitempty"`
+	End      *timecode.Timecode `json:"end,omitempty"`
+}
+
+// compiledEdits is an edit list turned into a single filter graph.
+type compiledEdits struct {
+	graph    ffmpeg.FilterGraph
+	out      streamLabels
+	duration float64
+}
+
+// compileEdits validates operations against the probed input and compiles
+// them into one filter graph.
+func compileEdits(operations []EditOperation, info *media.Info) (compiledEdits, error) {
+	video, ok := info.Video()
+	if !ok {
+		return compiledEdits{}, fmt.Errorf("no video stream")
+	}
+	if video.Width <= 0 || video.Height <= 0 {
+		return compiledEdits{}, fmt.Errorf("video stream has no dimensions")
+	}
+
+	fps := frameRate(info)
+
+	// frames are decoded already rotated
+	width, height := video.Width, video.Height
+	if info.Rotation == 90 || info.Rotation == 270 {
+		width, height = height, width
+	}
+
+	edits := compiledEdits{
+		out:      inputStreams(len(info.AudioStreams())),
+		duration: info.Duration,
+	}
+
+	for i, operation := range operations {
+		prefix := fmt.Sprintf("e%d", i)
+
+		switch operation.Op {
+		case EditTrim:
+			if len(operation.Ranges) == 0 {
+				return edits, fmt.Errorf("operation %d: no ranges provided", i+1)
+			}
+			if err := validateTrimRanges(operation.Ranges, fps, edits.duration); err != nil {
+				return edits, fmt.Errorf("operation %d: %w", i+1, err)
+			}
+
+			pieces := make([]videoPiece, len(operation.Ranges))
+			for j, trimRange := range operation.Ranges {
+				pieces[j] = videoPiece{start: trimRange.startSeconds, end: trimRange.endSeconds, factor: 1}
+			}
+			edits.addPieces(prefix, pieces)
+
+		case EditSpeed:
+			if len(operation.Segments) == 0 {
+				return edits, fmt.Errorf("operation %d: no segments provided", i+1)
+			}
+			if err := validateSpeedSegments(operation.Segments, fps, edits.duration); err != nil {
+				return edits, fmt.Errorf("operation %d: %w", i+1, err)
+			}
+			edits.addPieces(prefix, speedupPieces(operation.Segments, edits.duration))
+
+		case EditCrop:
+			w, h, x, y := operation.Width, operation.Height, operation.X, operation.Y
+			if w <= 0 || h <= 0 || x < 0 || y < 0 || x+w > width || y+h > height {
+				return edits, fmt.Errorf("operation %d: crop area must fit in the %dx%d video", i+1, width, height)
+			}
+			if w%2 != 0 || h%2 != 0 {
+				return edits, fmt.Errorf("operation %d: crop size must be even", i+1)
+			}
+			edits.addVideoFilter(prefix, ffmpeg.NewFilter("crop", strconv.Itoa(w), strconv.Itoa(h), strconv.Itoa(x), strconv.Itoa(y)))
+			width, height = w, h
+
+		case EditScale:
+			w, h, err := scaleDimensions(operation.Width, operation.Height, width, height)
+			if err != nil {
+				return edits, fmt.Errorf("operation %d: %w", i+1, err)
+			}
+			edits.addVideoFilter(prefix, ffmpeg.NewFilter("scale", strconv.Itoa(operation.Width), strconv.Itoa(operation.Height)))
+			width, height = w, h
+
+		case EditMute:
+			volume := ffmpeg.NewFilter("volume", "0")
+			if operation.Start != nil || operation.End != nil {
+				if operation.Start == nil || operation.End == nil {
+					return edits, fmt.Errorf("operation %d: mute needs both start and end", i+1)
+				}
+				start, end, err := validateRange(*operation.Start, *operation.End, 0, fps, edits.duration)
+				if err != nil {
+					return edits, fmt.Errorf("operation %d: %w", i+1, err)
+				}
+				enable := fmt.Sprintf("between(t,%s,%s)", ffmpeg.Seconds(start), ffmpeg.Seconds(end))
+				volume = ffmpeg.NewFilter("volume").With("enable", enable).With("volume", "0")
+			}
+			edits.addAudioFilter(prefix, volume)
+
+		default:
+			return edits, fmt.Errorf("operation %d: unknown operation %q", i+1, operation.Op)
+		}
+	}
+
+	return edits, nil
+}
+
+func (e *compiledEdits) addPieces(prefix string, pieces []videoPiece) {
+	e.out = piecesFilters(&e.graph, prefix, e.out, pieces)
+	e.duration = piecesDuration(pieces)
+}
+
+func (e *compiledEdits) addVideoFilter(prefix string, filter ffmpeg.Filter) {
+	label := prefix + "v"
+	e.graph.Add([]string{e.out.video}, []string{label}, filter)
+	e.out.video = label
+}
+
+func (e *compiledEdits) addAudioFilter(prefix string, filter ffmpeg.Filter) {
+	for a, audio := range e.out.audio {
+		label := fmt.Sprintf("%sa%d", prefix, a)
+		e.graph.Add([]string{audio}, []string{label}, filter)
+		e.out.audio[a] = label
+	}
+}
+
+// scaleDimensions validates the requested scale size and returns the
+// resulting one. A -2 dimension keeps the aspect ratio, rounded to even.
+// Sizes must be even, as the yuv420p output of libx264 requires.
+func scaleDimensions(w, h, width, height int) (int, int, error) {
+	valid := func(d int) bool { return d == -2 || (d > 0 && d <= maxEditDimension) }
+	if !valid(w) || !valid(h) || (w == -2 && h == -2) {
+		return 0, 0, fmt.Errorf("scale size must be positive and at most %d, or -2 for one side", maxEditDimension)
+	}
+	if w%2 != 0 || h%2 != 0 {
+		return 0, 0, fmt.Errorf("scale size must be even")
+	}
+
+	switch {
+	case w == -2:
+		w = (width*h/height + 1) &^ 1
+	case h == -2:
+		h = (height*w/width + 1) &^ 1
+	}
+
+	return w, h, nil
+}
+
+// VideoEditHandler applies an edit list to the uploaded video in a single
+// ffmpeg pass, in a background job.
+func VideoEditHandler(w http.ResponseWriter, r *http.Request) {
+	if !parseVideoForm(w, r) {
+		return
+	}
+
+	var operations []EditOperation
+	if err := json.Unmarshal([]byte(r.FormValue("edits")), &operations); err != nil {
+		http.Error(w, "Invalid edits JSON.", http.StatusBadRequest)
+		return
+	}
+	if len(operations) == 0 || len(operations) > maxEditOperations {
+		http.Error(w, fmt.Sprintf("Provide between 1 and %d edit operations.", maxEditOperations), http.StatusBadRequest)
+		return
+	}
+
+	tempDir, inputFile, info, ok := receiveVideoUpload(w, r)
+	if !ok {
+		return
+	}
+	submitted := false
+	defer func() {
+		if !submitted {
+			os.RemoveAll(tempDir)
+		}
+	}()
+
+	edits, err := compileEdits(operations, info)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid edits: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	submitted = submitVideoJob(w, tempDir, func(ctx context.Context, job *jobs.Job) (string, error) {
+		finalFile := filepath.Join(job.Dir, "final.mp4")
+		err := renderFilterGraph(ctx, job.ID, "edit", inputFile, finalFile, &edits.graph, edits.out, edits.duration)
+		if err != nil {
+			return "", fmt.Errorf("failed to edit video: %w", err)
+		}
+		return finalFile, nil
+	})
+}
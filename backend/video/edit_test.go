@@ -0,0 +1,108 @@
+package video
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"veedeo/ffmpeg"
+	"veedeo/media"
+)
+
+func testInfo(audioStreams int) *media.Info {
+	info := &media.Info{
+		Duration: 10,
+		Streams:  []media.Stream{{Type: media.StreamVideo, Codec: "h264", Width: 1280, Height: 720, FrameRate: 30}},
+	}
+	for a := 0; a < audioStreams; a++ {
+		info.Streams = append(info.Streams, media.Stream{Type: media.StreamAudio, Codec: "aac"})
+	}
+	return info
+}
+
+func TestCompileEditsArgs(t *testing.T) {
+	tests := []struct {
+		name         string
+		operations   []EditOperation
+		audioStreams int
+		want         string
+	}{
+		{
+			name:         "crop only",
+			operations:   []EditOperation{{Op: EditCrop, Width: 640, Height: 360, X: 10, Y: 20}},
+			audioStreams: 1,
+			want:         "-y -i input.mp4 -filter_complex [0:v:0]crop=640:360:10:20[e0v] -map [e0v] -map 0:a:0 -f mp4 final.mp4",
+		},
+		{
+			name:         "scale only",
+			operations:   []EditOperation{{Op: EditScale, Width: 640, Height: -2}},
+			audioStreams: 2,
+			want:         "-y -i input.mp4 -filter_complex [0:v:0]scale=640:-2[e0v] -map [e0v] -map 0:a:0 -map 0:a:1 -f mp4 final.mp4",
+		},
+		{
+			name:         "mute only",
+			operations:   []EditOperation{{Op: EditMute}},
+			audioStreams: 1,
+			want:         "-y -i input.mp4 -filter_complex [0:a:0]volume=0[e0a0] -map 0:v:0 -map [e0a0] -f mp4 final.mp4",
+		},
+		{
+			name:       "mute without audio",
+			operations: []EditOperation{{Op: EditMute}},
+			want:       "-y -i input.mp4 -map 0:v:0 -f mp4 final.mp4",
+		},
+		{
+			name: "crop then scale",
+			operations: []EditOperation{
+				{Op: EditCrop, Width: 640, Height: 360},
+				{Op: EditScale, Width: -2, Height: 180},
+			},
+			want: "-y -i input.mp4 -filter_complex [0:v:0]crop=640:360:0:0[e0v];[e0v]scale=-2:180[e1v] -map [e1v] -f mp4 final.mp4",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			edits, err := compileEdits(test.operations, testInfo(test.audioStreams))
+			if err != nil {
+				t.Fatalf("compileEdits() error = %v", err)
+			}
+
+			args := filterGraphCommand("input.mp4", "final.mp4", &edits.graph, edits.out).Args()
+			if got := strings.Join(args, " "); got != test.want {
+				t.Errorf("Args() = %q\nwant %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCompileEditsRejects(t *testing.T) {
+	tests := []struct {
+		name      string
+		operation EditOperation
+	}{
+		{"crop outside", EditOperation{Op: EditCrop, Width: 1280, Height: 720, X: 1}},
+		{"crop odd width", EditOperation{Op: EditCrop, Width: 641, Height: 360}},
+		{"crop odd height", EditOperation{Op: EditCrop, Width: 640, Height: 361}},
+		{"scale odd width", EditOperation{Op: EditScale, Width: 641, Height: -2}},
+		{"scale odd height", EditOperation{Op: EditScale, Width: 640, Height: 361}},
+		{"scale both -2", EditOperation{Op: EditScale, Width: -2, Height: -2}},
+		{"scale too large", EditOperation{Op: EditScale, Width: maxEditDimension + 2, Height: -2}},
+		{"unknown", EditOperation{Op: "blur"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := compileEdits([]EditOperation{test.operation}, testInfo(1)); err == nil {
+				t.Errorf("compileEdits(%+v) succeeded", test.operation)
+			}
+		})
+	}
+}
+
+func TestStreamLabelsMaps(t *testing.T) {
+	labels := streamLabels{video: "e0v", audio: []string{"0:a:0", "e1a1"}}
+
+	want := []ffmpeg.Map{"[e0v]", "0:a:0", "[e1a1]"}
+	if got := labels.maps(); !slices.Equal(got, want) {
+		t.Errorf("maps() = %v, want %v", got, want)
+	}
+}
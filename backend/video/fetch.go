@@ -0,0 +1,82 @@
+package video
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+	"veedeo/events"
+	"veedeo/fetch"
+	"veedeo/jobs"
+)
+
+// VideoURLImportHandler downloads the video file at the requested URL, such
+// as a presigned link to a bucket, in a background job, which stores it as
+// an asset and reports its ID in the assetId output.
+func VideoURLImportHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+	var videoReq VideoRequest
+	if err := json.NewDecoder(r.Body).Decode(&videoReq); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	u, err := url.Parse(videoReq.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		http.Error(w, "Invalid video URL: not an http(s) URL", http.StatusBadRequest)
+		return
+	}
+
+	tempDir, err := os.MkdirTemp("", "videoimport")
+	if err != nil {
+		http.Error(w, "Failed to create temporary directory", http.StatusInternalServerError)
+		return
+	}
+
+	submitted := submitVideoJob(w, tempDir, func(ctx context.Context, job *jobs.Job) (string, error) {
+		path := filepath.Join(job.Dir, "download")
+		if err := fetchVideo(ctx, fetch.Default(), job.ID, videoReq.URL, path); err != nil {
+			return "", err
+		}
+		return "", storeImportedVideo(ctx, job, path)
+	})
+	if !submitted {
+		os.RemoveAll(tempDir)
+	}
+}
+
+// fetchVideo downloads rawURL to path with fetcher, publishing the progress
+// to the SSE topic jobID.
+func fetchVideo(ctx context.Context, fetcher *fetch.Fetcher, jobID, rawURL, path string) error {
+	events.SseManager.UpdateProgress(jobID, events.Progress{Stage: "downloading"})
+
+	start := time.Now()
+	var lastReport time.Time
+	err := fetcher.Fetch(ctx, rawURL, path, func(written, total int64) {
+		if total <= 0 || time.Since(lastReport) < 500*time.Millisecond {
+			return
+		}
+		lastReport = time.Now()
+
+		percent := float64(written) / float64(total) * 100
+		progress := events.Progress{Stage: "downloading", Percent: percent}
+		if percent > 0 {
+			progress.ETA = time.Since(start).Seconds() * (100 - percent) / percent
+		}
+		events.SseManager.UpdateProgress(jobID, progress)
+	})
+
+	switch {
+	case errors.Is(err, fetch.ErrTooLarge):
+		return fmt.Errorf("video is larger than %d MB", fetcher.MaxSize/1024/1024)
+	case err != nil:
+		return fmt.Errorf("failed to download video: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package video
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"veedeo/events"
+	"veedeo/ffmpeg"
+	"veedeo/media"
+)
+
+// frameRate returns the frame rate of the video stream of info, or 0 when
+// unknown.
+func frameRate(info *media.Info) float64 {
+	video, _ := info.Video()
+	return video.FrameRate
+}
+
+// runFFmpeg runs cmd and publishes its progress for jobID under the given
+// stage name. duration is the expected length in seconds of the output and
+// is used to compute the percentage. On failure the returned bytes contain
+// ffmpeg's stderr. The process is killed when ctx is done.
+func runFFmpeg(ctx context.Context, jobID, stage string, duration float64, cmd *ffmpeg.Command) ([]byte, error) {
+	fmt.Println("Running:", cmd)
+	return cmd.Run(ctx, func(p ffmpeg.Progress) {
+		if p.Queued > 0 {
+			events.SseManager.UpdateProgress(jobID, events.Progress{Stage: "queued", Queue: p.Queued})
+			return
+		}
+
+		progress := events.Progress{Stage: stage, FPS: p.FPS}
+		if duration > 0 {
+			progress.Percent = math.Min(100, p.OutTime/duration*100)
+		}
+		if p.Speed > 0 {
+			remaining := duration * (100 - progress.Percent) / 100
+			progress.ETA = math.Round(remaining / p.Speed)
+		}
+		if p.Done {
+			progress.Percent = 100
+			progress.ETA = 0
+		}
+		events.SseManager.UpdateProgress(jobID, progress)
+	})
+}
@@ -0,0 +1,39 @@
+package video
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"veedeo/media"
+)
+
+// VideoProbeHandler returns the ffprobe metadata of the uploaded video,
+// sent as "videoFile" or referenced by "uploadId" or "assetId".
+func VideoProbeHandler(w http.ResponseWriter, r *http.Request) {
+	if !parseVideoForm(w, r) {
+		return
+	}
+
+	tempDir, err := os.MkdirTemp("", "videoprobe")
+	if err != nil {
+		http.Error(w, "Failed to create temporary directory", http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	if _, ok := saveVideoInput(w, r, "videoFile", tempDir, "input"); !ok {
+		return
+	}
+
+	info, err := media.Probe(r.Context(), filepath.Join(tempDir, "input"))
+	if err != nil {
+		fmt.Println("FFprobe Error:", err)
+		http.Error(w, "Invalid media file.", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
@@ -0,0 +1,350 @@
+package video
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"veedeo/ffmpeg"
+	"veedeo/timecode"
+)
+
+// minPieceDuration is the shortest gap worth cutting, shorter gaps between
+// segments are skipped since ffmpeg can't produce an empty part.
+const minPieceDuration = 0.05
+
+// Supported speed factors, below 1 the segment is slowed down.
+const (
+	minSpeedFactor = 0.1
+	maxSpeedFactor = 16
+)
+
+// atempo only accepts factors in [0.5, 2] on older ffmpeg builds and sounds
+// better when kept in this range, larger changes are chained.
+const (
+	minAtempo = 0.5
+	maxAtempo = 2.0
+)
+
+// What happens to the audio of a retimed segment.
+const (
+	AudioKeep = "keep"
+	AudioMute = "mute"
+)
+
+// SpeedSegment is a stretch of the video to retime. Start and End are
+// required timecodes in the original video. Audio is AudioKeep (default) or
+// AudioMute.
+type SpeedSegment struct {
+	Start  timecode.Timecode `json:"start"`
+	End    timecode.Timecode `json:"end"`
+	Factor float64           `json:"factor"`
+	Audio  string            `json:"audio,omitempty"`
+
+	startSeconds float64
+	endSeconds   float64
+}
+
+// videoPiece is a part of the output, cut from the original video between
+// start and end and played factor times faster.
+type videoPiece struct {
+	start  float64
+	end    float64
+	factor float64
+	mute   bool
+}
+
+// parseSpeedSegments reads the segments of a speedup request, either from the
+// "segments" JSON list or from the single startTime/endTime/speedupFactor
+// triple.
+func parseSpeedSegments(r *http.Request) ([]SpeedSegment, error) {
+	if segmentsJSON := r.FormValue("segments"); segmentsJSON != "" {
+		var segments []SpeedSegment
+		if err := json.Unmarshal([]byte(segmentsJSON), &segments); err != nil {
+			return nil, fmt.Errorf("invalid segments JSON: %w", err)
+		}
+		if len(segments) == 0 {
+			return nil, fmt.Errorf("no segments provided")
+		}
+		return segments, nil
+	}
+
+	speedupFactor, err := strconv.ParseFloat(r.FormValue("speedupFactor"), 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid speedupFactor value, please provide a valid number")
+	}
+
+	start, end, err := parseTimeFields(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return []SpeedSegment{{Start: start, End: end, Factor: speedupFactor}}, nil
+}
+
+// validateSpeedSegments resolves the timecodes of segments and checks that
+// they are ordered, don't overlap and fit in a video of the given frame
+// rate and duration.
+func validateSpeedSegments(segments []SpeedSegment, fps, duration float64) error {
+	previousEnd := 0.0
+	for i := range segments {
+		segment := &segments[i]
+
+		switch {
+		case segment.Factor < minSpeedFactor || segment.Factor > maxSpeedFactor:
+			return fmt.Errorf("segment %d: factor must be between %gx and %gx", i+1, float64(minSpeedFactor), float64(maxSpeedFactor))
+		case segment.Audio != "" && segment.Audio != AudioKeep && segment.Audio != AudioMute:
+			return fmt.Errorf("segment %d: audio must be %q or %q", i+1, AudioKeep, AudioMute)
+		}
+
+		start, end, err := validateRange(segment.Start, segment.End, previousEnd, fps, duration)
+		if err != nil {
+			return fmt.Errorf("segment %d: %w", i+1, err)
+		}
+
+		segment.startSeconds = start
+		segment.endSeconds = end
+		previousEnd = end
+	}
+
+	return nil
+}
+
+// parseTimeFields parses the startTime and endTime form values.
+func parseTimeFields(r *http.Request) (timecode.Timecode, timecode.Timecode, error) {
+	start, err := timecode.Parse(r.FormValue("startTime"))
+	if err != nil {
+		return start, start, fmt.Errorf("invalid startTime: %w", err)
+	}
+	end, err := timecode.Parse(r.FormValue("endTime"))
+	if err != nil {
+		return start, end, fmt.Errorf("invalid endTime: %w", err)
+	}
+	return start, end, nil
+}
+
+// validateRange resolves the start and end timecodes of a range and checks
+// that it begins after previousEnd and fits in a video of the given frame
+// rate and duration. The returned end is clamped to duration.
+func validateRange(start, end timecode.Timecode, previousEnd, fps, duration float64) (float64, float64, error) {
+	startSeconds, endSeconds, err := timecode.Range(start, end, fps, duration)
+	if err != nil {
+		return 0, 0, err
+	}
+	if startSeconds < previousEnd {
+		return 0, 0, fmt.Errorf("ranges must be ordered and must not overlap")
+	}
+
+	return startSeconds, endSeconds, nil
+}
+
+// speedupPieces splits the video into the retimed segments and the untouched
+// gaps around them.
+func speedupPieces(segments []SpeedSegment, duration float64) []videoPiece {
+	var pieces []videoPiece
+
+	position := 0.0
+	for _, segment := range segments {
+		if segment.startSeconds-position >= minPieceDuration {
+			pieces = append(pieces, videoPiece{start: position, end: segment.startSeconds, factor: 1})
+		}
+		pieces = append(pieces, videoPiece{
+			start:  segment.startSeconds,
+			end:    segment.endSeconds,
+			factor: segment.Factor,
+			mute:   segment.Audio == AudioMute,
+		})
+		position = segment.endSeconds
+	}
+	if duration-position >= minPieceDuration {
+		pieces = append(pieces, videoPiece{start: position, end: duration, factor: 1})
+	}
+
+	return pieces
+}
+
+// atempoChain returns the atempo filters changing the audio tempo by factor,
+// each of them within [minAtempo, maxAtempo].
+func atempoChain(factor float64) []ffmpeg.Filter {
+	var stages []ffmpeg.Filter
+	for factor > maxAtempo {
+		stages = append(stages, ffmpeg.NewFilter("atempo", ffmpeg.Float(maxAtempo)))
+		factor /= maxAtempo
+	}
+	for factor < minAtempo {
+		stages = append(stages, ffmpeg.NewFilter("atempo", ffmpeg.Float(minAtempo)))
+		factor /= minAtempo
+	}
+	stages = append(stages, ffmpeg.NewFilter("atempo", ffmpeg.Float(factor)))
+
+	return stages
+}
+
+// streamLabels names the video and audio streams flowing through a filter
+// graph, e.g. "0:v:0" or the output of a previous filter.
+type streamLabels struct {
+	video string
+	audio []string
+}
+
+// maps returns the output maps selecting the labeled streams. Streams no
+// filter touched are still input specifiers and are mapped as such, as no
+// filter outputs them.
+func (l streamLabels) maps() []ffmpeg.Map {
+	maps := []ffmpeg.Map{streamMap(l.video)}
+	for _, audio := range l.audio {
+		maps = append(maps, streamMap(audio))
+	}
+	return maps
+}
+
+func streamMap(label string) ffmpeg.Map {
+	// filter labels never contain a colon, specifiers such as 0:v:0 do
+	if strings.Contains(label, ":") {
+		return ffmpeg.MapStream(label)
+	}
+	return ffmpeg.MapLabel(label)
+}
+
+// inputStreams returns the labels of the first video stream and of the
+// first audioStreams audio streams of the first input.
+func inputStreams(audioStreams int) streamLabels {
+	labels := streamLabels{video: "0:v:0"}
+	for a := 0; a < audioStreams; a++ {
+		labels.audio = append(labels.audio, fmt.Sprintf("0:a:%d", a))
+	}
+	return labels
+}
+
+// piecesFilters adds to graph the filters cutting pieces out of the in
+// streams, retiming them and joining them back, so the input is decoded and
+// encoded only once. The labels it creates start with prefix, so that
+// several calls can share a graph, and the joined streams are returned.
+func piecesFilters(graph *ffmpeg.FilterGraph, prefix string, in streamLabels, pieces []videoPiece) streamLabels {
+	// every piece needs its own copy of each input stream
+	videoInputs := splitStream(graph, in.video, "split", prefix+"v", len(pieces))
+
+	audioInputs := make([][]string, len(in.audio))
+	for a, audio := range in.audio {
+		audioInputs[a] = splitStream(graph, audio, "asplit", fmt.Sprintf("%sa%d_", prefix, a), len(pieces))
+	}
+
+	var concatInputs []string
+	for i, piece := range pieces {
+		start, end := ffmpeg.Seconds(piece.start), ffmpeg.Seconds(piece.end)
+
+		// gaps are only cut, segments are retimed as well
+		videoFilters := []ffmpeg.Filter{
+			ffmpeg.NewFilter("trim").With("start", start).With("end", end),
+			ffmpeg.NewFilter("setpts", "PTS-STARTPTS"),
+		}
+		if piece.factor != 1 {
+			videoFilters = append(videoFilters, ffmpeg.NewFilter("setpts", fmt.Sprintf("%f*PTS", 1/piece.factor)))
+		}
+		videoLabel := fmt.Sprintf("%spv%d", prefix, i)
+		graph.Add([]string{videoInputs[i]}, []string{videoLabel}, videoFilters...)
+		concatInputs = append(concatInputs, videoLabel)
+
+		for a := range in.audio {
+			audioFilters := []ffmpeg.Filter{
+				ffmpeg.NewFilter("atrim").With("start", start).With("end", end),
+				ffmpeg.NewFilter("asetpts", "PTS-STARTPTS"),
+			}
+			if piece.factor != 1 {
+				audioFilters = append(audioFilters, atempoChain(piece.factor)...)
+			}
+			if piece.mute {
+				audioFilters = append(audioFilters, ffmpeg.NewFilter("volume", "0"))
+			}
+			audioLabel := fmt.Sprintf("%spa%d_%d", prefix, a, i)
+			graph.Add([]string{audioInputs[a][i]}, []string{audioLabel}, audioFilters...)
+			concatInputs = append(concatInputs, audioLabel)
+		}
+	}
+
+	out := streamLabels{video: prefix + "v"}
+	for a := range in.audio {
+		out.audio = append(out.audio, fmt.Sprintf("%sa%d", prefix, a))
+	}
+	concat := ffmpeg.NewFilter("concat").
+		With("n", strconv.Itoa(len(pieces))).
+		With("v", "1").
+		With("a", strconv.Itoa(len(in.audio)))
+	graph.Add(concatInputs, append([]string{out.video}, out.audio...), concat)
+
+	return out
+}
+
+// piecesDuration returns the length of pieces once joined.
+func piecesDuration(pieces []videoPiece) float64 {
+	duration := 0.0
+	for _, piece := range pieces {
+		duration += (piece.end - piece.start) / piece.factor
+	}
+	return duration
+}
+
+// splitStream duplicates input n times with the split or asplit filter,
+// naming the copies after prefix, and returns their labels. No filter is
+// needed for a single copy.
+func splitStream(graph *ffmpeg.FilterGraph, input, splitFilter, prefix string, n int) []string {
+	if n == 1 {
+		return []string{input}
+	}
+
+	labels := make([]string, n)
+	for i := range labels {
+		labels[i] = fmt.Sprintf("s%s%d", prefix, i)
+	}
+	graph.Add([]string{input}, labels, ffmpeg.NewFilter(splitFilter, strconv.Itoa(n)))
+
+	return labels
+}
+
+// speedupVideo retimes segments of the video at input and returns the path
+// of the resulting file, written inside workDir. The first audioStreams
+// audio streams of the input are kept. Progress is published to the SSE
+// topic jobID and the ffmpeg process is killed once ctx is done.
+func speedupVideo(ctx context.Context, jobID, workDir, input string, segments []SpeedSegment, audioStreams int, duration float64) (string, error) {
+	finalFile := filepath.Join(workDir, "final.mp4")
+
+	err := renderPieces(ctx, jobID, "speedup", input, finalFile, speedupPieces(segments, duration), audioStreams)
+	if err != nil {
+		return "", fmt.Errorf("failed to speed up video: %w", err)
+	}
+
+	return finalFile, nil
+}
+
+// renderPieces encodes pieces of input, joined in order, into an mp4 at
+// output in a single ffmpeg pass.
+func renderPieces(ctx context.Context, jobID, stage, input, output string, pieces []videoPiece, audioStreams int) error {
+	var graph ffmpeg.FilterGraph
+	out := piecesFilters(&graph, "", inputStreams(audioStreams), pieces)
+	return renderFilterGraph(ctx, jobID, stage, input, output, &graph, out, piecesDuration(pieces))
+}
+
+// renderFilterGraph runs graph over input and encodes the out streams into
+// an mp4 at output. duration is the expected length of the output.
+func renderFilterGraph(ctx context.Context, jobID, stage, input, output string, graph *ffmpeg.FilterGraph, out streamLabels, duration float64) error {
+	ffmpegOutput, err := runFFmpeg(ctx, jobID, stage, duration, filterGraphCommand(input, output, graph, out))
+	if err != nil {
+		fmt.Println("FFmpeg Output:", string(ffmpegOutput))
+		return err
+	}
+
+	return nil
+}
+
+// filterGraphCommand returns the command of renderFilterGraph.
+func filterGraphCommand(input, output string, graph *ffmpeg.FilterGraph, out streamLabels) *ffmpeg.Command {
+	return &ffmpeg.Command{
+		Overwrite: true,
+		Inputs:    []ffmpeg.Input{{Path: input}},
+		Graph:     graph,
+		Outputs:   []ffmpeg.Output{{Path: output, Maps: out.maps(), Format: "mp4"}},
+	}
+}
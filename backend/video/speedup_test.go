@@ -0,0 +1,106 @@
+package video
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"veedeo/ffmpeg"
+)
+
+const benchmarkDuration = 60.0
+
+// benchmarkInput generates a 720p video of benchmarkDuration seconds with a
+// stereo audio track, skipping the benchmark when ffmpeg is not installed.
+func benchmarkInput(b *testing.B) string {
+	b.Helper()
+
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		b.Skip("ffmpeg not installed")
+	}
+
+	input := filepath.Join(b.TempDir(), "input.mp4")
+	cmd := exec.Command("ffmpeg", "-y",
+		"-f", "lavfi", "-i", fmt.Sprintf("testsrc2=size=1280x720:rate=30:duration=%g", benchmarkDuration),
+		"-f", "lavfi", "-i", fmt.Sprintf("sine=frequency=440:sample_rate=48000:duration=%g", benchmarkDuration),
+		"-ac", "2", "-c:v", "libx264", "-c:a", "aac", "-shortest", input)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		b.Fatalf("failed to generate input: %v\n%s", err, output)
+	}
+
+	return input
+}
+
+// benchmarkSegments speeds up two parts of the input, leaving three gaps.
+func benchmarkSegments() []SpeedSegment {
+	return []SpeedSegment{
+		{Factor: 2, startSeconds: 10, endSeconds: 20},
+		{Factor: 4, startSeconds: 35, endSeconds: 50},
+	}
+}
+
+// BenchmarkSpeedupSinglePass measures speedupVideo, which renders every
+// piece in one filter_complex pass.
+func BenchmarkSpeedupSinglePass(b *testing.B) {
+	input := benchmarkInput(b)
+	segments := benchmarkSegments()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := speedupVideo(context.Background(), "benchmark", b.TempDir(), input, segments, 1, benchmarkDuration); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkSpeedupMultiPass measures the previous pipeline, one ffmpeg
+// process encoding each piece followed by a concat of the parts.
+func BenchmarkSpeedupMultiPass(b *testing.B) {
+	input := benchmarkInput(b)
+	pieces := speedupPieces(benchmarkSegments(), benchmarkDuration)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := speedupMultiPass(b.TempDir(), input, pieces); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func speedupMultiPass(workDir, input string, pieces []videoPiece) error {
+	var concatList strings.Builder
+	for i, piece := range pieces {
+		part := filepath.Join(workDir, fmt.Sprintf("part-%03d.mp4", i))
+
+		// the input is seeked to the piece, which then starts at 0
+		var graph ffmpeg.FilterGraph
+		shifted := videoPiece{end: piece.end - piece.start, factor: piece.factor, mute: piece.mute}
+		out := piecesFilters(&graph, "", inputStreams(1), []videoPiece{shifted})
+
+		_, err := (&ffmpeg.Command{
+			Overwrite: true,
+			Inputs:    []ffmpeg.Input{{Path: input, Seek: piece.start, To: piece.end}},
+			Graph:     &graph,
+			Outputs:   []ffmpeg.Output{{Path: part, Maps: out.maps(), Format: "mp4"}},
+		}).Run(context.Background(), nil)
+		if err != nil {
+			return fmt.Errorf("part %d: %w", i, err)
+		}
+		fmt.Fprintf(&concatList, "file '%s'\n", part)
+	}
+
+	listPath := filepath.Join(workDir, "concat.txt")
+	if err := os.WriteFile(listPath, []byte(concatList.String()), 0644); err != nil {
+		return err
+	}
+
+	_, err := (&ffmpeg.Command{
+		Overwrite: true,
+		Inputs:    []ffmpeg.Input{{Path: listPath, Format: "concat", Options: []string{"-safe", "0"}}},
+		Outputs:   []ffmpeg.Output{{Path: filepath.Join(workDir, "final.mp4"), Maps: []ffmpeg.Map{ffmpeg.MapStream("0")}, Codec: "copy"}},
+	}).Run(context.Background(), nil)
+	return err
+}
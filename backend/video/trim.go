@@ -0,0 +1,192 @@
+package video
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"veedeo/ffmpeg"
+	"veedeo/jobs"
+	"veedeo/media"
+	"veedeo/timecode"
+)
+
+// Trim modes: fast copies the streams so cuts snap to the previous
+// keyframe, accurate re-encodes to cut on the exact frame.
+const (
+	TrimFast     = "fast"
+	TrimAccurate = "accurate"
+)
+
+// TrimRange is a stretch of the video to keep. Start and End are required
+// timecodes in the original video.
+type TrimRange struct {
+	Start timecode.Timecode `json:"start"`
+	End   timecode.Timecode `json:"end"`
+
+	startSeconds float64
+	endSeconds   float64
+}
+
+// parseTrimRanges reads the ranges of a trim request, either from the
+// "ranges" JSON list or from the single startTime/endTime pair.
+func parseTrimRanges(r *http.Request) ([]TrimRange, error) {
+	rangesJSON := r.FormValue("ranges")
+	if rangesJSON == "" {
+		start, end, err := parseTimeFields(r)
+		if err != nil {
+			return nil, err
+		}
+		return []TrimRange{{Start: start, End: end}}, nil
+	}
+
+	var ranges []TrimRange
+	if err := json.Unmarshal([]byte(rangesJSON), &ranges); err != nil {
+		return nil, fmt.Errorf("invalid ranges JSON: %w", err)
+	}
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("no ranges provided")
+	}
+
+	return ranges, nil
+}
+
+func validateTrimRanges(ranges []TrimRange, fps, duration float64) error {
+	previousEnd := 0.0
+	for i := range ranges {
+		start, end, err := validateRange(ranges[i].Start, ranges[i].End, previousEnd, fps, duration)
+		if err != nil {
+			return fmt.Errorf("range %d: %w", i+1, err)
+		}
+
+		ranges[i].startSeconds = start
+		ranges[i].endSeconds = end
+		previousEnd = end
+	}
+
+	return nil
+}
+
+// VideoTrimHandler keeps the given ranges of the uploaded video, joined in a
+// single file, in a background job.
+func VideoTrimHandler(w http.ResponseWriter, r *http.Request) {
+	if !parseVideoForm(w, r) {
+		return
+	}
+
+	ranges, err := parseTrimRanges(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid ranges: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	mode := r.FormValue("mode")
+	if mode == "" {
+		mode = TrimAccurate
+	}
+	if mode != TrimFast && mode != TrimAccurate {
+		http.Error(w, fmt.Sprintf("Invalid mode, use %q or %q.", TrimFast, TrimAccurate), http.StatusBadRequest)
+		return
+	}
+
+	tempDir, inputFile, info, ok := receiveVideoUpload(w, r)
+	if !ok {
+		return
+	}
+	submitted := false
+	defer func() {
+		if !submitted {
+			os.RemoveAll(tempDir)
+		}
+	}()
+
+	err = validateTrimRanges(ranges, frameRate(info), info.Duration)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid ranges: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	submitted = submitVideoJob(w, tempDir, func(ctx context.Context, job *jobs.Job) (string, error) {
+		if mode == TrimFast {
+			return trimVideoFast(ctx, job.ID, job.Dir, inputFile, ranges)
+		}
+
+		pieces := make([]videoPiece, len(ranges))
+		for i, trimRange := range ranges {
+			pieces[i] = videoPiece{start: trimRange.startSeconds, end: trimRange.endSeconds, factor: 1}
+		}
+
+		finalFile := filepath.Join(job.Dir, "final.mp4")
+		err := renderPieces(ctx, job.ID, "trim", inputFile, finalFile, pieces, len(info.AudioStreams()))
+		if err != nil {
+			return "", fmt.Errorf("failed to trim video: %w", err)
+		}
+		return finalFile, nil
+	})
+}
+
+// trimVideoFast cuts ranges out of input without re-encoding and joins them.
+// Cuts are aligned to the keyframe preceding each range start.
+func trimVideoFast(ctx context.Context, jobID, workDir, input string, ranges []TrimRange) (string, error) {
+	// copied streams must stay in a container able to hold them
+	extension := ".mp4"
+	if container, err := media.Sniff(input); err == nil && (container == media.ContainerMKV || container == media.ContainerWebM) {
+		extension = "." + container
+	}
+	finalFile := filepath.Join(workDir, "final"+extension)
+
+	var concatContent strings.Builder
+	outputDuration := 0.0
+	for i, trimRange := range ranges {
+		partFile := filepath.Join(workDir, fmt.Sprintf("part-%03d%s", i, extension))
+		if len(ranges) == 1 {
+			partFile = finalFile
+		}
+
+		rangeDuration := trimRange.endSeconds - trimRange.startSeconds
+		outputDuration += rangeDuration
+
+		stage := fmt.Sprintf("cut %d/%d", i+1, len(ranges))
+		output, err := runFFmpeg(ctx, jobID, stage, rangeDuration, &ffmpeg.Command{
+			Overwrite: true,
+			Inputs:    []ffmpeg.Input{{Path: input, Seek: trimRange.startSeconds, To: trimRange.endSeconds}},
+			Outputs: []ffmpeg.Output{{
+				Path:    partFile,
+				Maps:    []ffmpeg.Map{ffmpeg.MapStream("0:v:0"), ffmpeg.MapStream("0:a?")},
+				Codec:   "copy",
+				Options: []string{"-avoid_negative_ts", "make_zero"},
+			}},
+		})
+		if err != nil {
+			fmt.Println("FFmpeg Output:", string(output))
+			return "", fmt.Errorf("failed to cut range %d: %w", i+1, err)
+		}
+
+		fmt.Fprintf(&concatContent, "file '%s'\n", partFile)
+	}
+
+	if len(ranges) == 1 {
+		return finalFile, nil
+	}
+
+	concatFile := filepath.Join(workDir, "concat.txt")
+	err := os.WriteFile(concatFile, []byte(concatContent.String()), 0644)
+	if err != nil {
+		return "", fmt.Errorf("failed to prepare concatenation list: %w", err)
+	}
+
+	output, err := runFFmpeg(ctx, jobID, "concatenation", outputDuration, &ffmpeg.Command{
+		Overwrite: true,
+		Inputs:    []ffmpeg.Input{{Path: concatFile, Format: "concat", Options: []string{"-safe", "0"}}},
+		Outputs:   []ffmpeg.Output{{Path: finalFile, Maps: []ffmpeg.Map{ffmpeg.MapStream("0")}, Codec: "copy"}},
+	})
+	if err != nil {
+		fmt.Println("FFmpeg Output:", string(output))
+		return "", fmt.Errorf("failed to concatenate ranges: %w", err)
+	}
+
+	return finalFile, nil
+}
@@ -2,16 +2,24 @@ package video
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strconv"
+	"time"
+	"veedeo/assets"
+	"veedeo/config"
 	"veedeo/events"
+	"veedeo/ffmpeg"
+	"veedeo/jobs"
+	"veedeo/media"
+	"veedeo/uploads"
 )
 
 // func downloadVideo(bucket, key, localPath string) error {
@@ -340,153 +348,212 @@ type Points struct {
 
 func VideoSpeedupHandler(w http.ResponseWriter, r *http.Request) {
 	// get video form
-	r.Body = http.MaxBytesReader(w, r.Body, 500*1024*1024)
-
-	err := r.ParseMultipartForm(32 << 20)
-	if err != nil {
-		http.Error(w, "Error parsing form or file too large.", http.StatusBadRequest)
+	if !parseVideoForm(w, r) {
 		return
 	}
 
-	file, header, err := r.FormFile("videoFile")
+	// get the segments to retime, with their speedup factors
+	segments, err := parseSpeedSegments(r)
 	if err != nil {
-		http.Error(w, "Error retrieving video file.", http.StatusBadRequest)
+		http.Error(w, fmt.Sprintf("Invalid segments: %v", err), http.StatusBadRequest)
 		return
 	}
-	defer file.Close()
 
-	if filepath.Ext(header.Filename) != ".mp4" {
-		http.Error(w, "Invalid file type. Only .mp4 allowed.", http.StatusBadRequest)
-		return
-	}
+	// drop the audio track entirely, e.g. for slow-motion clips
+	dropAudio := r.FormValue("audio") == "drop"
 
-	// setup temp directories
-	tempDir, err := os.MkdirTemp("", "videouploads")
-	if err != nil {
-		http.Error(w, "Failed to create temporary directory", http.StatusInternalServerError)
+	tempDir, inputFile, info, ok := receiveVideoUpload(w, r)
+	if !ok {
 		return
 	}
-	defer os.RemoveAll(tempDir)
+	submitted := false
+	defer func() {
+		if !submitted {
+			os.RemoveAll(tempDir)
+		}
+	}()
 
-	tempFile, err := os.CreateTemp(tempDir, "video-*.mp4")
+	err = validateSpeedSegments(segments, frameRate(info), info.Duration)
 	if err != nil {
-		http.Error(w, "Failed to create temporary file", http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Invalid segments: %v", err), http.StatusBadRequest)
 		return
 	}
-	defer tempFile.Close()
 
-	_, err = io.Copy(tempFile, file)
-	if err != nil {
-		http.Error(w, "Failed to save video file", http.StatusInternalServerError)
-		return
+	audioStreams := len(info.AudioStreams())
+	if dropAudio {
+		audioStreams = 0
 	}
 
-	beforePart := filepath.Join(tempDir, "before.mp4")
-	afterPart := filepath.Join(tempDir, "after.mp4")
-	speedupPart := filepath.Join(tempDir, "speedup.mp4")
-	finalFile := filepath.Join(tempDir, "final.mp4")
+	submitted = submitVideoJob(w, tempDir, func(ctx context.Context, job *jobs.Job) (string, error) {
+		return speedupVideo(ctx, job.ID, job.Dir, inputFile, segments, audioStreams, info.Duration)
+	})
+}
 
-	// get start time - end time - speedup factor from the request
-	startTime := r.FormValue("startTime")
-	endTime := r.FormValue("endTime")
-	speedupFactorStr := r.FormValue("speedupFactor")
-	speedupFactor, err := strconv.ParseFloat(speedupFactorStr, 64)
-	if err != nil {
-		fmt.Println("Error parsing speedupFactor:", err)
-		http.Error(w, "Invalid speedupFactor value. Please provide a valid number.", http.StatusBadRequest)
-		return
+// parseVideoForm parses the form of a video request, either multipart with
+// the video file or a plain form referencing an upload with "uploadId".
+func parseVideoForm(w http.ResponseWriter, r *http.Request) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, 500*1024*1024)
+
+	err := r.ParseMultipartForm(32 << 20)
+	if err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		http.Error(w, "Error parsing form or file too large.", http.StatusBadRequest)
+		return false
 	}
+	return true
+}
 
-	// update 1
-	events.SseManager.Update("0%")
+// saveVideoInput saves the video of the request as videoDir/filename, taken
+// from the asset referenced by the "assetId" form value, from the completed
+// upload referenced by "uploadId" or else from the fileField file of the
+// form. The probe info is returned for assets, which are validated already.
+// On failure the error has already been sent.
+func saveVideoInput(w http.ResponseWriter, r *http.Request, fileField, videoDir, filename string) (*media.Info, bool) {
+	assetID, uploadID := r.FormValue("assetId"), r.FormValue("uploadId")
+	if assetID == "" && uploadID == "" {
+		file, _, err := r.FormFile(fileField)
+		if err != nil {
+			http.Error(w, "Error retrieving video file.", http.StatusBadRequest)
+			return nil, false
+		}
+		defer file.Close()
 
-	// part 1: cut the video before the interested segment
-	cmd1 := exec.Command("ffmpeg", "-y", "-to", startTime, "-i", tempFile.Name(), "-filter_complex", "[0:v]setpts=PTS-STARTPTS[v];[0:a]aresample=async=1:first_pts=0[a]", "-map", "[v]", "-map", "[a]", "-f", "mp4", beforePart)
-	output1, err := cmd1.CombinedOutput()
-	if err != nil {
-		fmt.Println("FFmpeg Error (cut before):", err)
-		fmt.Println("FFmpeg Output:", string(output1))
-		http.Error(w, "Failed to cut video before segment", http.StatusInternalServerError)
-		return
+		err = saveVideoToDirectory(file, videoDir, filename)
+		if err != nil {
+			fmt.Println("Error saving video:", err)
+			http.Error(w, "Failed to save video file", http.StatusInternalServerError)
+			return nil, false
+		}
+		return nil, true
 	}
 
-	// update 2
-	events.SseManager.Update("30%")
+	err := os.MkdirAll(videoDir, os.ModePerm)
+	if err != nil {
+		http.Error(w, "Failed to create video directory", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	path := filepath.Join(videoDir, filename)
+	if assetID != "" {
+		asset, err := assets.AssetStore.CopyTo(r.Context(), assetID, path)
+		switch {
+		case errors.Is(err, assets.ErrNotFound):
+			http.Error(w, "Asset not found.", http.StatusNotFound)
+		case err != nil:
+			fmt.Println("Error using asset:", err)
+			http.Error(w, "Failed to read video asset", http.StatusInternalServerError)
+		default:
+			return asset.Info, true
+		}
+		return nil, false
+	}
+
+	err = uploads.UploadStore.CopyTo(uploadID, path)
+	switch {
+	case errors.Is(err, uploads.ErrNotFound):
+		http.Error(w, "Upload not found.", http.StatusNotFound)
+	case errors.Is(err, uploads.ErrIncomplete):
+		http.Error(w, "Upload is not complete.", http.StatusConflict)
+	case err != nil:
+		fmt.Println("Error using upload:", err)
+		http.Error(w, "Failed to read uploaded video", http.StatusInternalServerError)
+	default:
+		return nil, true
+	}
+	return nil, false
+}
 
-	// part 2: cut the video after the interested segment
-	cmd2 := exec.Command("ffmpeg", "-y", "-ss", endTime, "-i", tempFile.Name(), "-filter_complex", "[0:v]setpts=PTS-STARTPTS[v];[0:a]aresample=async=1:first_pts=0[a]", "-map", "[v]", "-map", "[a]", "-f", "mp4", afterPart)
-	output2, err := cmd2.CombinedOutput()
+// receiveVideoUpload saves the video of the parsed form, see saveVideoInput,
+// in a new temporary directory and validates it. On success the caller owns
+// the directory, otherwise the error has already been sent.
+func receiveVideoUpload(w http.ResponseWriter, r *http.Request) (string, string, *media.Info, bool) {
+	tempDir, err := os.MkdirTemp("", "videouploads")
 	if err != nil {
-		fmt.Println("FFmpeg Error (cut after):", err)
-		fmt.Println("FFmpeg Output:", string(output2))
-		http.Error(w, "Failed to cut video after segment", http.StatusInternalServerError)
-		return
+		http.Error(w, "Failed to create temporary directory", http.StatusInternalServerError)
+		return "", "", nil, false
 	}
 
-	// update 3
-	events.SseManager.Update("60%")
-
-	// part 3: speed up the trimmed part
-	setptsMultiplier := 1 / speedupFactor
-	speedupFilter := fmt.Sprintf("[0:v]setpts=PTS-STARTPTS,setpts=%f*PTS[v];[0:a]atempo=%f[a]", setptsMultiplier, speedupFactor)
-	cmd3 := exec.Command("ffmpeg", "-y", "-ss", startTime, "-to", endTime, "-i", tempFile.Name(),
-		"-filter_complex", speedupFilter, "-map", "[v]", "-map", "[a]", "-f", "mp4", speedupPart)
-	output3, err := cmd3.CombinedOutput()
-	if err != nil {
-		fmt.Println("FFmpeg Error (speedup):", err)
-		fmt.Println("FFmpeg Output:", string(output3))
-		http.Error(w, "Failed to speed up video segment", http.StatusInternalServerError)
-		return
+	inputFile := filepath.Join(tempDir, "input")
+	info, ok := saveVideoInput(w, r, "videoFile", tempDir, filepath.Base(inputFile))
+	if ok && info == nil {
+		info, ok = checkUploadedMedia(w, r, inputFile)
+	}
+	if !ok {
+		os.RemoveAll(tempDir)
+		return "", "", nil, false
 	}
 
-	concatFile := filepath.Join(tempDir, "concat.txt")
-	concatContent := fmt.Sprintf("file '%s'\nfile '%s'\nfile '%s'\n", beforePart, speedupPart, afterPart)
+	return tempDir, inputFile, info, true
+}
 
-	err = os.WriteFile(concatFile, []byte(concatContent), 0644)
+// submitVideoJob hands tempDir over to a new job running fn and replies 202
+// with the job state. It reports whether the job was accepted. The job queue
+// is the only admission check: once accepted, the ffmpeg commands of the job
+// wait for the limiter instead of failing when it is busy.
+func submitVideoJob(w http.ResponseWriter, tempDir string, fn jobs.Func) bool {
+	job, err := jobs.Default().Submit(tempDir, func(ctx context.Context, job *jobs.Job) (string, error) {
+		return fn(ffmpeg.Admitted(ctx), job)
+	})
+	if errors.Is(err, jobs.ErrQueueFull) || errors.Is(err, jobs.ErrShuttingDown) {
+		replyBusy(w)
+		return false
+	}
 	if err != nil {
-		http.Error(w, "Failed to prepare concatenation list", http.StatusInternalServerError)
-		return
+		http.Error(w, "Failed to start video processing", http.StatusInternalServerError)
+		return false
 	}
 
-	// update 4
-	events.SseManager.Update("80%")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/jobs/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job.State())
+	return true
+}
 
-	// part 4: replace the trimmed part in the original video
-	cmd4 := exec.Command("ffmpeg", "-f", "concat", "-safe", "0", "-i", concatFile, "-c", "copy", finalFile)
-	output4, err := cmd4.CombinedOutput()
-	if err != nil {
-		fmt.Println("FFmpeg Error (concatenation):", err)
-		fmt.Println("FFmpeg Output:", string(output4))
-		http.Error(w, "Failed to concatenate video", http.StatusInternalServerError)
-		return
-	}
+// busyRetryAfter is how long clients are told to wait when the server is
+// busy.
+const busyRetryAfter = 30 * time.Second
 
-	// update final
-	events.SseManager.Update("100%")
+// replyBusy replies 503 with a Retry-After header, when too many videos are
+// already being processed.
+func replyBusy(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(busyRetryAfter.Seconds())))
+	http.Error(w, "Too many videos are being processed, try again later.", http.StatusServiceUnavailable)
+}
 
-	// send the video to the frontend
-	outFile, err := os.Open(finalFile)
+// checkUploadedMedia validates the uploaded file at path against the media
+// allowlist, replying with 415 for unsupported media.
+func checkUploadedMedia(w http.ResponseWriter, r *http.Request, path string) (*media.Info, bool) {
+	info, err := media.DefaultAllowlist().Check(r.Context(), path)
+	if errors.Is(err, media.ErrUnsupported) {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return nil, false
+	}
 	if err != nil {
-		http.Error(w, "Failed to open output file", http.StatusInternalServerError)
-		return
+		fmt.Println("Error checking media:", err)
+		http.Error(w, "Failed to read video file", http.StatusInternalServerError)
+		return nil, false
 	}
-	defer outFile.Close()
 
-	w.Header().Set("Content-Type", "video/mp4")
-	w.Header().Set("Content-Disposition", "attachment; filename=processed-video.mp4")
+	return info, true
+}
 
-	_, err = io.Copy(w, outFile)
-	if err != nil {
-		http.Error(w, "Failed to send processed video", http.StatusInternalServerError)
-		return
+// claimJobID returns the job id chosen by the client, so that it can
+// subscribe to /ffmpeg-events before the upload starts, or a new one. The id
+// is claimed as an SSE topic, ok is false when it is already in use by
+// another request or job.
+func claimJobID(r *http.Request) (id string, ok bool) {
+	id = r.FormValue("jobId")
+	if !events.ValidJobID(id) {
+		id = events.NewJobID()
 	}
+	if _, exists := jobs.Default().Get(id); exists {
+		return "", false
+	}
+	return id, events.SseManager.Claim(id)
 }
 
 func getSam2SegBaseDir() string {
-	if dir := os.Getenv("SAM2SEG_SHARED_DIR"); dir != "" {
-		return dir
-	}
-	return "../local/sam2seg"
+	return config.Current().SAM2Seg.SharedDir
 }
 
 func saveVideoToDirectory(file multipart.File, videoDir, filename string) error {
@@ -510,19 +577,28 @@ func saveVideoToDirectory(file multipart.File, videoDir, filename string) error
 	return nil
 }
 
-func extractFramesToDirectory(videoPath, framesDir string) error {
+func extractFramesToDirectory(ctx context.Context, jobID, videoPath, framesDir string) error {
 	err := os.MkdirAll(framesDir, os.ModePerm)
 	if err != nil {
 		return fmt.Errorf("failed to create frames directory: %w", err)
 	}
 
-	cmd := exec.Command("ffmpeg",
-		"-i", videoPath,
-		"-q:v", "3",
-		"-start_number", "0",
-		fmt.Sprintf("%s/%%05d.jpg", framesDir))
-
-	output, err := cmd.CombinedOutput()
+	// progress is only informative here, keep going without a duration
+	duration := 0.0
+	info, err := media.Probe(ctx, videoPath)
+	if err != nil {
+		fmt.Println("FFprobe Error:", err)
+	} else {
+		duration = info.Duration
+	}
+
+	output, err := runFFmpeg(ctx, jobID, "extracting frames", duration, &ffmpeg.Command{
+		Inputs: []ffmpeg.Input{{Path: videoPath}},
+		Outputs: []ffmpeg.Output{{
+			Path:    filepath.Join(framesDir, "%05d.jpg"),
+			Options: []string{"-q:v", "3", "-start_number", "0"},
+		}},
+	})
 	if err != nil {
 		return fmt.Errorf("failed to extract frames: %w\nOutput: %s", err, string(output))
 	}
@@ -530,16 +606,22 @@ func extractFramesToDirectory(videoPath, framesDir string) error {
 	return nil
 }
 
-func cleanDirectories(videoDir, framesDir string) error {
-	if err := os.RemoveAll(videoDir); err != nil {
-		return fmt.Errorf("failed to clean video directory: %w", err)
+// createSam2SegSession creates a directory under the sam2seg shared dir that
+// holds the video and frames of a single segmentation request. The returned
+// name is relative to the shared dir, as expected by sam2seg.
+func createSam2SegSession() (string, string, error) {
+	sessionsDir := filepath.Join(getSam2SegBaseDir(), "sessions")
+	err := os.MkdirAll(sessionsDir, os.ModePerm)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create sessions directory: %w", err)
 	}
 
-	if err := os.RemoveAll(framesDir); err != nil {
-		return fmt.Errorf("failed to clean frames directory: %w", err)
+	sessionDir, err := os.MkdirTemp(sessionsDir, "session-")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create session directory: %w", err)
 	}
 
-	return nil
+	return sessionDir, filepath.Join("sessions", filepath.Base(sessionDir)), nil
 }
 
 func VideoLocalInferenceHandler(w http.ResponseWriter, r *http.Request) {
@@ -548,13 +630,8 @@ func VideoLocalInferenceHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	baseDir := getSam2SegBaseDir()
-	videoDir := filepath.Join(baseDir, "video")
-	framesDir := filepath.Join(baseDir, "frames")
-
-	// clean local dir before attempting a new segmentation
-	if err := cleanDirectories(videoDir, framesDir); err != nil {
-		http.Error(w, fmt.Sprintf("Error cleaning directories: %v", err), http.StatusInternalServerError)
+	if ffmpeg.DefaultLimiter().Full() || jobs.Default().ShuttingDown() {
+		replyBusy(w)
 		return
 	}
 
@@ -565,21 +642,45 @@ func VideoLocalInferenceHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	videoFile, _, err := r.FormFile("video")
+	// every request works in its own session dir, removed once the
+	// segmented video has been sent back
+	sessionDir, sessionName, err := createSam2SegSession()
 	if err != nil {
-		http.Error(w, "Error retrieving the video file", http.StatusBadRequest)
+		http.Error(w, fmt.Sprintf("Error creating session: %v", err), http.StatusInternalServerError)
 		return
 	}
-	defer videoFile.Close()
+	defer os.RemoveAll(sessionDir)
 
-	err = saveVideoToDirectory(videoFile, videoDir, "to_segment.mp4")
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Error saving video: %v", err), http.StatusInternalServerError)
+	videoDir := filepath.Join(sessionDir, "video")
+	framesDir := filepath.Join(sessionDir, "frames")
+
+	jobID, ok := claimJobID(r)
+	if !ok {
+		http.Error(w, "Job id already in use", http.StatusConflict)
+		return
+	}
+	defer events.SseManager.Forget(jobID)
+	w.Header().Set("X-Job-ID", jobID)
+
+	events.SseManager.UpdateProgress(jobID, events.Progress{Stage: "saving video"})
+
+	info, ok := saveVideoInput(w, r, "video", videoDir, "to_segment.mp4")
+	if !ok {
 		return
 	}
 
 	videoPath := filepath.Join(videoDir, "to_segment.mp4")
-	err = extractFramesToDirectory(videoPath, framesDir)
+	if info == nil {
+		if _, ok := checkUploadedMedia(w, r, videoPath); !ok {
+			return
+		}
+	}
+
+	err = extractFramesToDirectory(r.Context(), jobID, videoPath, framesDir)
+	if errors.Is(err, ffmpeg.ErrBusy) {
+		replyBusy(w)
+		return
+	}
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error extracting frames: %v", err), http.StatusInternalServerError)
 		return
@@ -613,6 +714,17 @@ func VideoLocalInferenceHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	sessionPart, err := writer.CreateFormField("session")
+	if err != nil {
+		http.Error(w, "Error creating form field for session", http.StatusInternalServerError)
+		return
+	}
+	_, err = sessionPart.Write([]byte(sessionName))
+	if err != nil {
+		http.Error(w, "Error writing session to form field", http.StatusInternalServerError)
+		return
+	}
+
 	imagePart, err := writer.CreateFormFile("image", imageFileHeader.Filename)
 	if err != nil {
 		http.Error(w, "Error creating form file for image", http.StatusInternalServerError)
@@ -631,19 +743,16 @@ func VideoLocalInferenceHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// send the POST inference request to the python backend
-	// Use environment variable for Docker compatibility, default to localhost for local dev
-	pythonHost := os.Getenv("SAM2SEG_HOST")
-	if pythonHost == "" {
-		pythonHost = "localhost:9000"
-	}
-	pythonURL := fmt.Sprintf("http://%s/segment", pythonHost)
-	req, err := http.NewRequest("POST", pythonURL, body)
+	pythonURL := fmt.Sprintf("http://%s/segment", config.Current().SAM2Seg.Host)
+	req, err := http.NewRequestWithContext(r.Context(), "POST", pythonURL, body)
 	if err != nil {
 		http.Error(w, "Error creating Python server request", http.StatusInternalServerError)
 		return
 	}
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 
+	events.SseManager.UpdateProgress(jobID, events.Progress{Stage: "segmenting"})
+
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
@@ -652,6 +761,8 @@ func VideoLocalInferenceHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer resp.Body.Close()
 
+	events.SseManager.UpdateProgress(jobID, events.Progress{Stage: "done", Percent: 100})
+
 	// get and send to frontend the segmentation result
 	contentType := resp.Header.Get("Content-Type")
 	if contentType == "application/json" {
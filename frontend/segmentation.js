@@ -221,16 +221,79 @@ showTrimButton.addEventListener("click", () => {
   showSegmentButton.style.color = "white";
 });
 
-showSpeedupButton.addEventListener("click", () => {
-  const ffmpegEventSource = new EventSource(BACKEND_URL + "/ffmpeg-events");
+// subscribe to the progress events of a single job
+function subscribeToJobEvents(jobId) {
+  const ffmpegEventSource = new EventSource(
+    BACKEND_URL + "/ffmpeg-events?job=" + encodeURIComponent(jobId)
+  );
 
   ffmpegEventSource.onmessage = function (event) {
-    ffmpegMessage.innerHTML = event.data;
+    const progress = JSON.parse(event.data);
+    if (progress.stage === "shutting down") {
+      ffmpegMessage.innerHTML = "server shutting down";
+      return;
+    }
+    if (progress.queue) {
+      ffmpegMessage.innerHTML = `queued - position ${progress.queue}`;
+      return;
+    }
+    let message = `${progress.stage} ${Math.round(progress.percent)}%`;
+    if (progress.fps) {
+      message += ` - ${Math.round(progress.fps)} fps`;
+    }
+    if (progress.eta) {
+      message += ` - ${progress.eta}s left`;
+    }
+    ffmpegMessage.innerHTML = message;
   };
   ffmpegEventSource.onerror = function () {
     setTimeout(() => (ffmpegMessage.innerHTML = ""), 1000);
   };
 
+  return ffmpegEventSource;
+}
+
+// cancel the running job if the page is closed, so the backend can stop ffmpeg
+let runningJobUrl = null;
+window.addEventListener("pagehide", () => {
+  if (runningJobUrl) {
+    fetch(runningJobUrl, { method: "DELETE", keepalive: true });
+  }
+});
+
+// poll the job until it's finished, then fetch its result
+async function waitForJobResult(jobId) {
+  const jobUrl = BACKEND_URL + "/jobs/" + encodeURIComponent(jobId);
+  runningJobUrl = jobUrl;
+  try {
+    return await pollJobResult(jobUrl);
+  } finally {
+    runningJobUrl = null;
+  }
+}
+
+async function pollJobResult(jobUrl) {
+
+  while (true) {
+    const jobResponse = await fetch(jobUrl);
+    if (!jobResponse.ok) {
+      throw new Error(`Error fetching job. Status: ${jobResponse.status}`);
+    }
+
+    const job = await jobResponse.json();
+    if (job.status === "done") {
+      // signed link, relative to the backend unless it points to S3
+      return fetch(new URL(job.resultUrl, BACKEND_URL));
+    }
+    if (job.status === "failed" || job.status === "canceled") {
+      throw new Error(`Job ${job.status}: ${job.error || ""}`);
+    }
+
+    await new Promise((resolve) => setTimeout(resolve, 1000));
+  }
+}
+
+showSpeedupButton.addEventListener("click", () => {
   ffmpegInputsContainer.style.display = "flex";
   speedupButton.style.display = "block";
   trimButtonFast.style.display = "none";
@@ -344,6 +407,34 @@ trimButtonFast.addEventListener("click", async () => {
   endTimestampInput.value = null;
 });
 
+// each video is uploaded once as an asset, so trying other settings on it
+// doesn't upload it again
+const videoAssetIds = new WeakMap();
+
+async function getVideoAssetId(videoFile) {
+  if (!videoAssetIds.has(videoFile)) {
+    const formData = new FormData();
+    formData.append("videoFile", videoFile);
+
+    const assetResponse = await fetch(BACKEND_URL + "/assets", {
+      method: "POST",
+      body: formData,
+    });
+    if (!assetResponse.ok) {
+      throw new Error(
+        `Error uploading video. Status: ${
+          assetResponse.status
+        } - ${await assetResponse.text()}`
+      );
+    }
+
+    const { id } = await assetResponse.json();
+    videoAssetIds.set(videoFile, id);
+  }
+
+  return videoAssetIds.get(videoFile);
+}
+
 speedupButton.addEventListener("click", async () => {
   const startTrimValue =
     startTimestampInput.value === "00:00:00.000"
@@ -356,35 +447,44 @@ speedupButton.addEventListener("click", async () => {
 
   if (videoInputFile) {
     try {
+      ffmpegInputsContainer.style.display = "none";
+      loadingSpinnerContainer.style.display = "flex";
+
       const formData = new FormData();
-      formData.append("videoFile", videoInputFile);
+      formData.append("assetId", await getVideoAssetId(videoInputFile));
       formData.append("startTime", startTrimValue);
       formData.append("endTime", endTrimValue);
       formData.append("speedupFactor", speedupFactorInput.value);
 
-      ffmpegInputsContainer.style.display = "none";
-      loadingSpinnerContainer.style.display = "flex";
-
-      const speedupVideoResponse = await fetch(BACKEND_URL + "/video/speedup", {
+      const speedupJobResponse = await fetch(BACKEND_URL + "/video/speedup", {
         method: "POST",
         body: formData,
       });
 
-      if (speedupVideoResponse.ok) {
-        const speedupVideoblob = await speedupVideoResponse.blob();
-        videoPlayer.src = URL.createObjectURL(speedupVideoblob);
-        videoPlayer.load();
-
-        ffmpegInputsContainer.style.display = "flex";
-        loadingSpinnerContainer.style.display = "none";
-      } else {
-        console.error(
-          "Error fetching speedup video. Status:",
-          speedupVideoResponse.status
+      if (!speedupJobResponse.ok) {
+        // the asset expired, upload the video again next time
+        if (speedupJobResponse.status === 404) {
+          videoAssetIds.delete(videoInputFile);
+        }
+        throw new Error(
+          `Error starting speedup job. Status: ${
+            speedupJobResponse.status
+          } - ${await speedupJobResponse.text()}`
         );
-        const errorText = await speedupVideoResponse.text();
-        console.error("Error details:", errorText);
       }
+
+      const { id: jobId } = await speedupJobResponse.json();
+      const ffmpegEventSource = subscribeToJobEvents(jobId);
+      const speedupVideoResponse = await waitForJobResult(jobId).finally(() =>
+        ffmpegEventSource.close()
+      );
+
+      const speedupVideoblob = await speedupVideoResponse.blob();
+      videoPlayer.src = URL.createObjectURL(speedupVideoblob);
+      videoPlayer.load();
+
+      ffmpegInputsContainer.style.display = "flex";
+      loadingSpinnerContainer.style.display = "none";
     } catch (error) {
       console.error("Error fetching speedup video.", error);
       return;
@@ -347,9 +347,21 @@ def propagate_and_sink_in_video(inference_state, temp_dir, video_info, frames_pa
                 next_log_threshold = processed_percentage + percentage_step
 
 
+def resolve_session_dirs(session: Optional[str]):
+    # without a session fall back to the legacy shared video/frames dirs
+    if not session:
+        return SHARED_VIDEO_DIR, SHARED_FRAMES_DIR
+
+    session_dir = os.path.abspath(os.path.join(SAM2SEG_SHARED_DIR, session))
+    if os.path.commonpath([session_dir, SAM2SEG_SHARED_DIR]) != SAM2SEG_SHARED_DIR or session_dir == SAM2SEG_SHARED_DIR:
+        raise ValueError(f"Invalid session: {session}")
+
+    return os.path.join(session_dir, "video"), os.path.join(session_dir, "frames")
+
 @app.post("/segment")
 def segment(
     segmentationData: Optional[str] = Form(None),
+    session: Optional[str] = Form(None),
     image: Optional[UploadFile] = File(None),
 ):
     temp_dir = tempfile.mkdtemp()
@@ -357,9 +369,18 @@ def segment(
     cleanup_required = True
 
     try:
+        try:
+            video_dir, frames_dir = resolve_session_dirs(session)
+        except ValueError as exc:
+            logger.error("Invalid session directory: %s", exc)
+            return JSONResponse(
+                status_code=400,
+                content={"error": str(exc), "status": "error"},
+            )
+
         video_name = "to_segment.mp4"
-        local_video_path = os.path.join(SHARED_VIDEO_DIR, video_name)
-        local_frames_path = SHARED_FRAMES_DIR
+        local_video_path = os.path.join(video_dir, video_name)
+        local_frames_path = frames_dir
 
         if not os.path.exists(local_video_path):
             parent_dir = os.path.dirname(local_video_path)